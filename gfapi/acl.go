@@ -0,0 +1,111 @@
+package gfapi
+
+// This file includes the POSIX ACL helpers built on the extended attributes of fd
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// aclAccessXattr is the extended attribute holding the access ACL of a file
+const aclAccessXattr = "system.posix_acl_access"
+
+// aclXattrVersion is the version of the binary ACL format, POSIX_ACL_XATTR_VERSION
+const aclXattrVersion = 2
+
+// ACLTag is the type of an ACL entry
+type ACLTag uint16
+
+// The ACL entry types, with the same values as the ACL_* tags of the kernel
+const (
+	ACLUserObj  ACLTag = 0x01
+	ACLUser     ACLTag = 0x02
+	ACLGroupObj ACLTag = 0x04
+	ACLGroup    ACLTag = 0x08
+	ACLMask     ACLTag = 0x10
+	ACLOther    ACLTag = 0x20
+)
+
+// ACLUndefinedID is the ID of the entries which don't name a user or group,
+// ie. all but ACLUser and ACLGroup
+const ACLUndefinedID = 0xffffffff
+
+// ACLEntry is an entry of an ACL. Perm holds the read (4), write (2) and
+// execute (1) permission bits, and ID the user or group the entry applies to.
+type ACLEntry struct {
+	Tag  ACLTag
+	Perm uint16
+	ID   uint32
+}
+
+// ACL is a POSIX access control list
+type ACL []ACLEntry
+
+// ErrInvalidACL is returned when an ACL attribute can't be decoded
+var ErrInvalidACL = errors.New("invalid ACL attribute")
+
+// The encoded ACL is the posix_acl_xattr format used by Linux since 2.6: a
+// little-endian 32 bit version, which must be 2, followed by one 8 byte
+// record per entry made of a 16 bit tag, a 16 bit perm and a 32 bit id.
+const (
+	aclHeaderSize = 4
+	aclEntrySize  = 8
+)
+
+func encodeACL(acl ACL) []byte {
+	b := make([]byte, aclHeaderSize+aclEntrySize*len(acl))
+	binary.LittleEndian.PutUint32(b, aclXattrVersion)
+	for i, e := range acl {
+		p := b[aclHeaderSize+aclEntrySize*i:]
+		binary.LittleEndian.PutUint16(p, uint16(e.Tag))
+		binary.LittleEndian.PutUint16(p[2:], e.Perm)
+		binary.LittleEndian.PutUint32(p[4:], e.ID)
+	}
+	return b
+}
+
+func decodeACL(b []byte) (ACL, error) {
+	if len(b) < aclHeaderSize || (len(b)-aclHeaderSize)%aclEntrySize != 0 {
+		return nil, ErrInvalidACL
+	}
+	if binary.LittleEndian.Uint32(b) != aclXattrVersion {
+		return nil, ErrInvalidACL
+	}
+
+	acl := make(ACL, 0, (len(b)-aclHeaderSize)/aclEntrySize)
+	for p := b[aclHeaderSize:]; len(p) > 0; p = p[aclEntrySize:] {
+		acl = append(acl, ACLEntry{
+			Tag:  ACLTag(binary.LittleEndian.Uint16(p)),
+			Perm: binary.LittleEndian.Uint16(p[2:]),
+			ID:   binary.LittleEndian.Uint32(p[4:]),
+		})
+	}
+	return acl, nil
+}
+
+// GetACL returns the access ACL of the file, read from the
+// system.posix_acl_access extended attribute. The volume must have been
+// mounted with ACL support on the bricks, as Linux provides it.
+//
+// Returns ErrNoAttr if the file has no ACL beyond its mode, ErrInvalidACL if
+// the attribute isn't in the supported format and error on failure
+func (fd *Fd) GetACL() (ACL, error) {
+	b, err := fd.GetxattrAll(aclAccessXattr)
+	if err != nil {
+		return nil, err
+	}
+	return decodeACL(b)
+}
+
+// SetACL sets the access ACL of the file, writing the
+// system.posix_acl_access extended attribute. A valid ACL holds exactly one
+// ACLUserObj, ACLGroupObj and ACLOther entry, and an ACLMask entry if it has
+// any ACLUser or ACLGroup entry. The validation is left to the server.
+//
+// Returns error on failure
+func (fd *Fd) SetACL(acl ACL) error {
+	err := fd.Fsetxattr(aclAccessXattr, encodeACL(acl), 0)
+	// The access ACL carries the permission bits of the mode
+	fd.statChanged()
+	return err
+}
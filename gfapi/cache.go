@@ -0,0 +1,144 @@
+package gfapi
+
+// This file includes a block cache for positional reads on fd
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"syscall"
+)
+
+// DefaultCacheBlocks is the number of blocks kept by a CachingReaderAt when
+// none is given
+const DefaultCacheBlocks = 64
+
+// CachingReaderAt is an io.ReaderAt reading an Fd through a least recently
+// used cache of fixed-size blocks, for workloads reading the same parts of a
+// file again and again. It is safe for concurrent use.
+//
+// The cache doesn't notice changes of the file, Invalidate must be called
+// when the file is known to have changed.
+type CachingReaderAt struct {
+	fd        *Fd
+	blockSize int64
+	maxBlocks int
+
+	mu sync.Mutex
+	// lru holds the *cacheBlock values, most recently used first
+	lru    *list.List
+	blocks map[int64]*list.Element
+	// gen is incremented by Invalidate, so blocks read before it aren't cached
+	gen uint64
+}
+
+type cacheBlock struct {
+	idx int64
+	// data is shorter than the block size for the last block of the file
+	data []byte
+}
+
+// NewCachingReaderAt returns a CachingReaderAt reading fd in blocks of
+// blockSize bytes and keeping at most maxBlocks blocks. A blockSize of 0 means
+// the preferred I/O size of the file, and a maxBlocks of 0 DefaultCacheBlocks.
+//
+// Returns error on failure
+func NewCachingReaderAt(fd *Fd, blockSize int64, maxBlocks int) (*CachingReaderAt, error) {
+	if blockSize < 0 || maxBlocks < 0 {
+		return nil, syscall.EINVAL
+	}
+	if blockSize == 0 {
+		var stat syscall.Stat_t
+		if err := fd.Fstat(&stat); err != nil {
+			return nil, err
+		}
+		blockSize = int64(stat.Blksize)
+		if blockSize <= 0 {
+			blockSize = DefaultCopyBufferSize
+		}
+	}
+	if maxBlocks == 0 {
+		maxBlocks = DefaultCacheBlocks
+	}
+
+	return &CachingReaderAt{
+		fd:        fd,
+		blockSize: blockSize,
+		maxBlocks: maxBlocks,
+		lru:       list.New(),
+		blocks:    make(map[int64]*list.Element),
+	}, nil
+}
+
+// ReadAt reads len(p) bytes into p from offset off, from the cached blocks
+// when possible and otherwise reading the missing blocks from the Fd
+//
+// Returns number of bytes read and an error if fewer than len(p) bytes were
+// read, io.EOF if the file ended first
+func (c *CachingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, syscall.EINVAL
+	}
+
+	for n < len(p) {
+		pos := off + int64(n)
+		data, err := c.block(pos / c.blockSize)
+		if err != nil {
+			return n, err
+		}
+
+		start := pos % c.blockSize
+		if start >= int64(len(data)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], data[start:])
+	}
+	return n, nil
+}
+
+// block returns the data of the block idx, reading it on a cache miss
+func (c *CachingReaderAt) block(idx int64) ([]byte, error) {
+	c.mu.Lock()
+	if e, ok := c.blocks[idx]; ok {
+		c.lru.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*cacheBlock).data, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	data := make([]byte, c.blockSize)
+	n, err := c.fd.ReadAt(data, idx*c.blockSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	data = data[:n]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return data, nil
+	}
+	if e, ok := c.blocks[idx]; ok {
+		// Read concurrently by another caller
+		c.lru.MoveToFront(e)
+		return data, nil
+	}
+	c.blocks[idx] = c.lru.PushFront(&cacheBlock{idx: idx, data: data})
+	if c.lru.Len() > c.maxBlocks {
+		oldest := c.lru.Remove(c.lru.Back()).(*cacheBlock)
+		delete(c.blocks, oldest.idx)
+	}
+	return data, nil
+}
+
+// Invalidate drops all the cached blocks, so the following reads see the
+// current contents of the file
+func (c *CachingReaderAt) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.lru.Init()
+	clear(c.blocks)
+}
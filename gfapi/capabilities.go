@@ -0,0 +1,84 @@
+package gfapi
+
+// This file includes the runtime probing of the optional libgfapi operations
+
+// #cgo pkg-config: glusterfs-api
+// #cgo linux LDFLAGS: -ldl
+// #define _GNU_SOURCE
+// #include <dlfcn.h>
+// #include <stdlib.h>
+// #include "glusterfs/api/glfs.h"
+//
+// static void *gfapi_symbol(const char *name) {
+// 	return dlsym(RTLD_DEFAULT, name);
+// }
+//
+// static int gfapi_zerofill(void *fn, glfs_fd_t *fd, off_t offset, off_t len) {
+// 	return ((int (*)(glfs_fd_t *, off_t, off_t))fn)(fd, offset, len);
+// }
+import "C"
+import (
+	"sync"
+	"unsafe"
+)
+
+// Caps reports which of the optional libgfapi operations are provided by the
+// libgfapi loaded by the process. Operations which aren't listed are provided
+// by every supported libgfapi, like glfs_fallocate which the package calls
+// directly, or aren't used by the package.
+//
+// libgfapi has no fadvise, the operations relying on it are never available.
+type Caps struct {
+	// Zerofill is glfs_zerofill, added in glusterfs 3.5
+	Zerofill bool
+}
+
+var capabilities = sync.OnceValue(func() Caps {
+	return Caps{
+		Zerofill: zerofillSymbol() != nil,
+	}
+})
+
+// zerofillSymbol is the address of glfs_zerofill, nil when it isn't defined
+var zerofillSymbol = sync.OnceValue(func() unsafe.Pointer {
+	return symbol("glfs_zerofill")
+})
+
+// Capabilities returns the optional operations provided by the loaded
+// libgfapi. The symbols are looked up on the first call only.
+func Capabilities() Caps {
+	return capabilities()
+}
+
+// symbol returns the address of the symbol name in the process, nil when it
+// isn't defined
+func symbol(name string) unsafe.Pointer {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	return C.gfapi_symbol(cname)
+}
+
+// zerofill writes zeros to the length bytes from offset with glfs_zerofill,
+// looked up at run time as it is missing from old libgfapi releases
+//
+// Returns ErrNotSupported if glfs_zerofill isn't available, and error on
+// failure
+func (fd *Fd) zerofill(offset int64, length int64) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+
+	fn := zerofillSymbol()
+	if fn == nil {
+		return ErrNotSupported
+	}
+
+	ret, err := C.gfapi_zerofill(fn, fd.fd, C.off_t(offset), C.off_t(length))
+	fd.statChanged()
+
+	if ret == 0 {
+		err = nil
+	}
+	return err
+}
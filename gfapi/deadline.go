@@ -0,0 +1,149 @@
+package gfapi
+
+// This file includes the read and write deadlines of an Fd, and the sync
+// with a timeout
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+import "C"
+import (
+	"os"
+	"time"
+)
+
+// SetReadDeadline sets the deadline for future Read calls on the Fd. A Read
+// which doesn't complete before the deadline returns os.ErrDeadlineExceeded.
+// A zero t means Read will not time out.
+//
+// libgfapi calls can't be interrupted, so a Read with a deadline is run in a
+// separate goroutine on a private buffer. On timeout that call is abandoned:
+// it keeps running in the background, and the data it reads is discarded
+// although the file offset may still advance. Close waits for the abandoned
+// calls to complete before closing the Fd.
+//
+// Returns error on failure
+func (fd *Fd) SetReadDeadline(t time.Time) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+	fd.readDeadline.Store(deadlineNanos(t))
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls on the Fd. A
+// Write which doesn't complete before the deadline returns
+// os.ErrDeadlineExceeded. A zero t means Write will not time out.
+//
+// As with SetReadDeadline, a timed out Write is abandoned but not cancelled,
+// so the data may still be written to the file after Write has returned.
+//
+// Returns error on failure
+func (fd *Fd) SetWriteDeadline(t time.Time) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+	fd.writeDeadline.Store(deadlineNanos(t))
+	return nil
+}
+
+// SyncTimeout performs an fsync on the Fd like Fsync, giving up after d.
+// On a degraded cluster an fsync can block for minutes, SyncTimeout lets
+// latency-sensitive callers shed load instead of piling up blocked requests.
+//
+// Like a Read past its deadline, a timed out fsync is abandoned but not
+// cancelled: it keeps running in the background and the data may still
+// become durable after SyncTimeout has returned. Close waits for it to
+// complete before closing the Fd.
+//
+// Returns os.ErrDeadlineExceeded if the fsync didn't complete within d, and
+// error on failure
+func (fd *Fd) SyncTimeout(d time.Duration) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+	if d <= 0 {
+		return os.ErrDeadlineExceeded
+	}
+
+	// The glfd is read under inflight, so Close can't close it under the
+	// background fsync
+	fd.inflight.RLock()
+	cfd := fd.fd
+	if cfd == nil {
+		fd.inflight.RUnlock()
+		return ErrClosed
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer fd.inflight.RUnlock()
+		done <- fsync(cfd, nil, nil)
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+func deadlineNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// withDeadline runs op on a private copy of b and waits for it until the
+// deadline given in unix nanoseconds. When in is true b is copied into the
+// buffer before op, otherwise the bytes op produced are copied back into b.
+//
+// op is given the glfd of the Fd read once before it starts, and holds
+// inflight until it returns, so an abandoned op never sees the Fd closed under
+// it.
+func (fd *Fd) withDeadline(deadline int64, b []byte, in bool, op func(cfd *C.glfs_fd_t, b []byte) (int, error)) (int, error) {
+	timeout := time.Until(time.Unix(0, deadline))
+	if timeout <= 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	fd.inflight.RLock()
+	cfd := fd.fd
+	if cfd == nil {
+		fd.inflight.RUnlock()
+		return 0, ErrClosed
+	}
+
+	buf := make([]byte, len(b))
+	if in {
+		copy(buf, b)
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer fd.inflight.RUnlock()
+		n, err := op(cfd, buf)
+		done <- result{n, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		if !in && r.n > 0 {
+			copy(b, buf[:r.n])
+		}
+		return r.n, r.err
+	case <-timer.C:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
@@ -8,7 +8,18 @@ package gfapi
 // #include <sys/stat.h>
 import "C"
 import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -17,6 +28,30 @@ import (
 // Fd is the glusterfs fd type
 type Fd struct {
 	fd *C.glfs_fd_t
+	// flags the fd was opened with
+	flags int
+	// isDir is set when the fd was opened with glfs_opendir
+	isDir bool
+	// mu serializes operations which need more than one call on the fd
+	mu sync.Mutex
+	// inflight is held for reading by the calls run in the background by the
+	// deadlines and SyncTimeout, and for writing by Close, which thus waits
+	// for them before closing the glfd they use
+	inflight sync.RWMutex
+	// copyBufSize is the buffer size of the streaming helpers, 0 for the default
+	copyBufSize int64
+	// readDeadline and writeDeadline are the deadlines of Read and Write in
+	// unix nanoseconds, 0 for none
+	readDeadline  atomic.Int64
+	writeDeadline atomic.Int64
+	// statCaching enables the caching of the stat used by Size, Mode and
+	// ModTime in cachedStat, nil when no stat is cached
+	statCaching atomic.Bool
+	cachedStat  atomic.Pointer[syscall.Stat_t]
+	// statGen is incremented by InvalidateStat, so a stat fetched before it
+	// isn't cached. statMu guards statGen and the stores to cachedStat.
+	statMu  sync.Mutex
+	statGen uint64
 }
 
 type Stat struct {
@@ -67,47 +102,216 @@ func (s *Stat) ToGlfsStat() *C.struct_glfs_stat {
 		glfs_st_mask:            C.ulong(s.mask),
 		glfs_st_attributes:      C.ulong(s.attributes),
 		glfs_st_attributes_mask: C.ulong(s.attributesMask),
-		glfs_st_atime: C.struct_timespec{
-			tv_sec:  C.__time_t(s.atime.Unix()),
-			tv_nsec: C.__syscall_slong_t(s.atime.Nanosecond()),
-		},
-		glfs_st_btime: C.struct_timespec{
-			tv_sec:  C.__time_t(s.btime.Unix()),
-			tv_nsec: C.__syscall_slong_t(s.btime.Nanosecond()),
-		},
-		glfs_st_ctime: C.struct_timespec{
-			tv_sec:  C.__time_t(s.ctime.Unix()),
-			tv_nsec: C.__syscall_slong_t(s.ctime.Nanosecond()),
-		},
-		glfs_st_ino:        C.ulong(s.ino),
-		glfs_st_size:       C.long(s.size),
-		glfs_st_blocks:     C.long(s.blocks),
-		glfs_st_rdev_major: C.uint(s.rdevMajor),
-		glfs_st_rdev_minor: C.uint(s.rdevMinor),
-		glfs_st_dev_major:  C.uint(s.devMajor),
-		glfs_st_dev_minor:  C.uint(s.devMinor),
-		glfs_st_nlink:      C.ulong(s.nlink),
-		glfs_st_uid:        C.uint(s.uid),
-		glfs_st_gid:        C.uint(s.gid),
-		glfs_st_mode:       C.uint(s.mode),
+		glfs_st_atime:           toTimespec(s.atime),
+		glfs_st_btime:           toTimespec(s.btime),
+		glfs_st_ctime:           toTimespec(s.ctime),
+		glfs_st_mtime:           toTimespec(s.mtime),
+		glfs_st_ino:             C.ulong(s.ino),
+		glfs_st_size:            C.long(s.size),
+		glfs_st_blocks:          C.long(s.blocks),
+		glfs_st_rdev_major:      C.uint(s.rdevMajor),
+		glfs_st_rdev_minor:      C.uint(s.rdevMinor),
+		glfs_st_dev_major:       C.uint(s.devMajor),
+		glfs_st_dev_minor:       C.uint(s.devMinor),
+		glfs_st_blksize:         C.long(s.blkksize),
+		glfs_st_nlink:           C.ulong(s.nlink),
+		glfs_st_uid:             C.uint(s.uid),
+		glfs_st_gid:             C.uint(s.gid),
+		glfs_st_mode:            C.uint(s.mode),
+	}
+}
+
+// toTimespec converts t to a timespec, the zero time.Time being converted to
+// a zero timespec
+func toTimespec(t time.Time) C.struct_timespec {
+	if t.IsZero() {
+		return C.struct_timespec{}
+	}
+
+	return C.struct_timespec{
+		tv_sec:  C.__time_t(t.Unix()),
+		tv_nsec: C.__syscall_slong_t(t.Nanosecond()),
+	}
+}
+
+// fromTimespec is the reverse of toTimespec, it returns the time of ts in UTC
+// with its nanoseconds, and the zero time for a zero timespec
+func fromTimespec(ts C.struct_timespec) time.Time {
+	if ts.tv_sec == 0 && ts.tv_nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(ts.tv_sec), int64(ts.tv_nsec)).UTC()
+}
+
+// FromGlfsStat returns a Stat populated from the given glfs_stat structure
+func FromGlfsStat(gs *C.struct_glfs_stat) *Stat {
+	if gs == nil {
+		return nil
+	}
+
+	return &Stat{
+		mask:           uint64(gs.glfs_st_mask),
+		attributes:     uint64(gs.glfs_st_attributes),
+		attributesMask: uint64(gs.glfs_st_attributes_mask),
+		atime:          fromTimespec(gs.glfs_st_atime),
+		btime:          fromTimespec(gs.glfs_st_btime),
+		ctime:          fromTimespec(gs.glfs_st_ctime),
+		mtime:          fromTimespec(gs.glfs_st_mtime),
+		ino:            uint64(gs.glfs_st_ino),
+		size:           int64(gs.glfs_st_size),
+		blocks:         uint64(gs.glfs_st_blocks),
+		rdevMajor:      uint32(gs.glfs_st_rdev_major),
+		rdevMinor:      uint32(gs.glfs_st_rdev_minor),
+		devMajor:       uint32(gs.glfs_st_dev_major),
+		devMinor:       uint32(gs.glfs_st_dev_minor),
+		blkksize:       int64(gs.glfs_st_blksize),
+		nlink:          uint64(gs.glfs_st_nlink),
+		uid:            uint32(gs.glfs_st_uid),
+		gid:            uint32(gs.glfs_st_gid),
+		mode:           uint32(gs.glfs_st_mode),
 	}
 }
 
 var _zero uintptr
 
-// Fchmod changes the mode of the Fd to the given mode
+// Offsets are passed to libgfapi as off_t, which must be 64-bit for offsets
+// past 2GB not to be silently truncated. Building fails here otherwise.
+var (
+	_ [unsafe.Sizeof(C.off_t(0)) - 8]byte
+	_ [8 - unsafe.Sizeof(C.off_t(0))]byte
+)
+
+// ErrNotSupported is returned by operations which the installed libgfapi
+// doesn't provide. It satisfies errors.Is(err, syscall.ENOSYS).
+var ErrNotSupported = fmt.Errorf("operation not supported by libgfapi: %w", syscall.ENOSYS)
+
+// ErrClosed is returned when operating on an Fd which has been closed or was
+// never opened. It satisfies errors.Is(err, os.ErrClosed).
+var ErrClosed = fmt.Errorf("fd is not open: %w", os.ErrClosed)
+
+// ErrNotClosed is returned when rebinding an Fd which is still open, as the
+// open descriptor would be leaked
+var ErrNotClosed = errors.New("fd is still open")
+
+// ErrIsDirectory is returned when writing to or truncating an Fd of a
+// directory. It satisfies errors.Is(err, syscall.EISDIR).
+var ErrIsDirectory = fmt.Errorf("fd is a directory: %w", syscall.EISDIR)
+
+// ErrNotDirectory is returned when reading the entries of an Fd which isn't a
+// directory. It satisfies errors.Is(err, syscall.ENOTDIR).
+var ErrNotDirectory = fmt.Errorf("fd is not a directory: %w", syscall.ENOTDIR)
+
+// ErrReadOnly is returned when modifying an Fd which wasn't opened for
+// writing. It satisfies errors.Is(err, syscall.EBADF).
+var ErrReadOnly = fmt.Errorf("fd is not open for writing: %w", syscall.EBADF)
+
+// ErrTooLarge is returned by ReadAllCapped when the file is larger than the
+// given limit
+var ErrTooLarge = errors.New("file is larger than the limit")
+
+// ErrSeekNotSupported is returned by SeekData and SeekHole when the volume
+// doesn't support seeking for data or holes. Callers can fall back to treating
+// the whole file as data. It satisfies errors.Is(err, syscall.EOPNOTSUPP).
+var ErrSeekNotSupported = fmt.Errorf("SEEK_DATA/SEEK_HOLE not supported: %w", syscall.EOPNOTSUPP)
+
+// Errno returns the syscall.Errno carried by err, which is either an errno
+// itself or wraps one, like the *os.PathError of a File and the errors of this
+// package which stand for an errno. It is a shorthand for errors.As, for
+// callers logging or translating the raw errno while matching errors with
+// errors.Is.
+//
+// Returns false if err carries no errno, e.g. ErrClosed which is detected
+// before reaching libgfapi
+func Errno(err error) (syscall.Errno, bool) {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno, true
+	}
+	return 0, false
+}
+
+// Fchmod changes the mode of the Fd to the given raw posix mode
 //
 // Returns error on failure
 func (fd *Fd) Fchmod(mode uint32) error {
-	_, err := C.glfs_fchmod(fd.fd, C.mode_t(mode))
+	if fd.fd == nil {
+		return ErrClosed
+	}
 
-	return err
+	ret, err := C.glfs_fchmod(fd.fd, C.mode_t(mode))
+	fd.statChanged()
+	if int(ret) < 0 {
+		return err
+	}
+	return nil
+}
+
+// Chmod changes the mode of the Fd to the given mode. Only the permission,
+// setuid, setgid and sticky bits of mode are used.
+//
+// Returns error on failure
+func (fd *Fd) Chmod(mode os.FileMode) error {
+	return fd.Fchmod(posixMode(mode))
+}
+
+// SetMode .. SetMtime are the bits of the valid mask of Fsetattr, telling
+// which fields of the Stat are applied
+const (
+	SetMode  = statMode
+	SetUid   = statUid
+	SetGid   = statGid
+	SetAtime = statAtime
+	SetMtime = statMtime
+)
+
+// FchmodPrev changes the mode of the Fd to the given raw posix mode like
+// Fchmod, and returns the permission, setuid, setgid and sticky bits of the
+// mode it had before. It is still an fstat followed by an fchmod, a
+// concurrent change of the mode between the two is lost.
+//
+// Returns the previous mode and error on failure
+func (fd *Fd) FchmodPrev(mode uint32) (oldMode uint32, err error) {
+	var stat syscall.Stat_t
+	if err := fd.Fstat(&stat); err != nil {
+		return 0, err
+	}
+	if err := fd.Fchmod(mode); err != nil {
+		return 0, err
+	}
+	return uint32(stat.Mode) &^ syscall.S_IFMT, nil
+}
+
+// Fsetattr sets the attributes of the Fd selected by the valid mask to the
+// values of s, in a single call. valid is a combination of SetMode, SetUid,
+// SetGid, SetAtime and SetMtime.
+//
+// Returns error on failure
+func (fd *Fd) Fsetattr(s *Stat, valid int) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+	if s == nil {
+		return syscall.EINVAL
+	}
+
+	gs := s.ToGlfsStat()
+	gs.glfs_st_mask = C.ulong(valid)
+
+	ret, err := C.glfs_fsetattr(fd.fd, gs)
+	fd.statChanged()
+	if ret < 0 {
+		return err
+	}
+	return nil
 }
 
 // Fstat performs an fstat call on the Fd and saves stat details in the passed stat structure
 //
 // Returns error on failure
 func (fd *Fd) Fstat(stat *syscall.Stat_t) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
 
 	ret, err := C.glfs_fstat(fd.fd, (*C.struct_stat)(unsafe.Pointer(stat)))
 	if int(ret) < 0 {
@@ -116,109 +320,1361 @@ func (fd *Fd) Fstat(stat *syscall.Stat_t) error {
 	return nil
 }
 
+// Size returns the current size of the file referred to by the Fd, which
+// makes it simple to wrap the Fd in an io.SectionReader. See SetStatCaching.
+//
+// Returns error on failure
+func (fd *Fd) Size() (int64, error) {
+	stat, err := fd.stat()
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Size), nil
+}
+
+// Mode returns the mode of the file referred to by the Fd. See SetStatCaching.
+//
+// Returns error on failure
+func (fd *Fd) Mode() (os.FileMode, error) {
+	stat, err := fd.stat()
+	if err != nil {
+		return 0, err
+	}
+	return GlfsToMode(uint32(stat.Mode)), nil
+}
+
+// ModTime returns the last data modification time of the file referred to by
+// the Fd. See SetStatCaching.
+//
+// Returns error on failure
+func (fd *Fd) ModTime() (time.Time, error) {
+	stat, err := fd.stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return timespecToTime(getLastModification(stat)), nil
+}
+
+// SetStatCaching enables or disables the caching of the stat used by Size,
+// Mode and ModTime. It is disabled by default, so each of them does an Fstat.
+// When enabled the first of them does the Fstat and the following ones reuse
+// its result, saving the round trips of read-only traversals.
+//
+// The cached stat is dropped by InvalidateStat and by the changes made through
+// the Fd, like writes, truncates, chmods and ACL changes. The changes made by other clients
+// or through other Fds aren't noticed.
+func (fd *Fd) SetStatCaching(enabled bool) {
+	fd.statCaching.Store(enabled)
+	if !enabled {
+		fd.InvalidateStat()
+	}
+}
+
+// InvalidateStat drops the stat cached for Size, Mode and ModTime, so the
+// next of them does an Fstat again
+func (fd *Fd) InvalidateStat() {
+	fd.statMu.Lock()
+	defer fd.statMu.Unlock()
+
+	fd.statGen++
+	fd.cachedStat.Store(nil)
+}
+
+// statChanged drops the cached stat after a change made through the Fd. It
+// does nothing unless stat caching is enabled, sparing the writes the lock.
+func (fd *Fd) statChanged() {
+	if fd.statCaching.Load() {
+		fd.InvalidateStat()
+	}
+}
+
+// stat returns the cached stat of the Fd when stat caching is enabled, and
+// otherwise the result of an Fstat, which is cached if caching is enabled
+func (fd *Fd) stat() (*syscall.Stat_t, error) {
+	caching := fd.statCaching.Load()
+	if caching {
+		if stat := fd.cachedStat.Load(); stat != nil {
+			return stat, nil
+		}
+	}
+
+	fd.statMu.Lock()
+	gen := fd.statGen
+	fd.statMu.Unlock()
+
+	stat := new(syscall.Stat_t)
+	if err := fd.Fstat(stat); err != nil {
+		return nil, err
+	}
+	if caching {
+		fd.statMu.Lock()
+		defer fd.statMu.Unlock()
+		// Don't cache a stat possibly older than a change made meanwhile
+		if fd.statGen == gen {
+			fd.cachedStat.Store(stat)
+		}
+	}
+	return stat, nil
+}
+
+// reset rebinds a closed Fd to cfd opened with flags, clearing the state kept
+// for the previous descriptor
+//
+// Returns ErrNotClosed if the Fd is still open
+func (fd *Fd) reset(cfd *C.glfs_fd_t, flags int, isDir bool) error {
+	if fd.fd != nil {
+		return ErrNotClosed
+	}
+	fd.fd = cfd
+	fd.flags = flags
+	fd.isDir = isDir
+	fd.copyBufSize = 0
+	fd.readDeadline.Store(0)
+	fd.writeDeadline.Store(0)
+	fd.statCaching.Store(false)
+	fd.InvalidateStat()
+	return nil
+}
+
+// checkWritable returns ErrIsDirectory for an Fd of a directory and
+// ErrReadOnly for an Fd opened without write access, so such writes fail
+// before reaching the server
+func (fd *Fd) checkWritable() error {
+	if fd.isDir {
+		return ErrIsDirectory
+	}
+	if fd.flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// Statvfs describes the space available on a volume. Blocks, BlocksFree and
+// BlocksAvail are counted in units of BlockSize, so Blocks * BlockSize is the
+// size of the volume in bytes.
+type Statvfs struct {
+	// BlockSize is the fragment size of the volume in bytes
+	BlockSize uint64
+	// Blocks is the size of the volume in blocks
+	Blocks uint64
+	// BlocksFree is the number of free blocks
+	BlocksFree uint64
+	// BlocksAvail is the number of free blocks available to unprivileged users
+	BlocksAvail uint64
+	// Files is the number of inodes
+	Files uint64
+	// FilesFree is the number of free inodes
+	FilesFree uint64
+}
+
+// Statvfs returns the filesystem statistics of the volume the Fd belongs to.
+// libgfapi has no glfs_fstatvfs, the statistics are those of the root of the
+// volume which holds the Fd.
+//
+// Returns error on failure
+func (fd *Fd) Statvfs() (*Statvfs, error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+
+	fs, err := C.glfs_from_glfd(fd.fd)
+	if fs == nil {
+		return nil, err
+	}
+
+	var buf Statvfs_t
+	croot := C.CString("/")
+	defer C.free(unsafe.Pointer(croot))
+
+	ret, err := C.glfs_statvfs(fs, croot, (*C.struct_statvfs)(unsafe.Pointer(&buf)))
+	if ret < 0 {
+		return nil, err
+	}
+
+	return &Statvfs{
+		BlockSize:   uint64(buf.Frsize),
+		Blocks:      uint64(buf.Blocks),
+		BlocksFree:  uint64(buf.Bfree),
+		BlocksAvail: uint64(buf.Bavail),
+		Files:       uint64(buf.Files),
+		FilesFree:   uint64(buf.Ffree),
+	}, nil
+}
+
 // Fsync performs an fsync on the Fd
 //
+// Deprecated: the cgo typed stat arguments can't be provided from outside of
+// this package, use SyncStat instead.
+//
 // Returns error on failure
 func (fd *Fd) Fsync(prestat, poststat *C.struct_glfs_stat) error {
-	ret, err := C.glfs_fsync(fd.fd, prestat, poststat)
+	if fd.fd == nil {
+		return ErrClosed
+	}
+	return fsync(fd.fd, prestat, poststat)
+}
+
+// fsync performs an fsync on the glfd cfd
+func fsync(cfd *C.glfs_fd_t, prestat, poststat *C.struct_glfs_stat) (err error) {
+	if obs := loadMetricsObserver(); obs != nil {
+		defer observe(obs, "fsync", time.Now(), nil, &err)
+	}
+	if l := loadLogger(); l != nil {
+		defer logOp(l, "fsync", nil, &err)
+	}
+
+	_, err = ignoringEINTR(func() (int, error) {
+		ret, err := C.glfs_fsync(cfd, prestat, poststat)
+		return int(ret), err
+	})
+	return err
+}
+
+// ignoringEINTR calls fn, a libgfapi call returning a negative value along
+// with errno on failure, until it isn't interrupted by a signal, like the os
+// package does for the system calls
+//
+// Returns the result of fn, with a nil error unless it is negative
+func ignoringEINTR(fn func() (int, error)) (int, error) {
+	for {
+		ret, err := fn()
+		if ret >= 0 {
+			return ret, nil
+		}
+		if err != syscall.EINTR {
+			return ret, err
+		}
+	}
+}
+
+// SyncStat performs an fsync on the Fd
+//
+// Returns the stat of the file before and after the sync, and error on failure
+func (fd *Fd) SyncStat() (pre *Stat, post *Stat, err error) {
+	var prestat, poststat C.struct_glfs_stat
+
+	if err := fd.Fsync(&prestat, &poststat); err != nil {
+		return nil, nil, err
+	}
+	return FromGlfsStat(&prestat), FromGlfsStat(&poststat), nil
+}
+
+// Datasync performs an fdatasync on the Fd, committing the data of the file
+// but not necessarily all of its metadata to the storage. When the volume
+// doesn't support fdatasync a full fsync is done instead, so the data is
+// durable whenever Datasync succeeds.
+//
+// Returns error on failure, the error of the fdatasync if the fsync fallback
+// fails too
+func (fd *Fd) Datasync() error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+
+	ret, err := ignoringEINTR(func() (int, error) {
+		ret, err := C.glfs_fdatasync(fd.fd, nil, nil)
+		return int(ret), err
+	})
+	if ret < 0 {
+		if err == syscall.EOPNOTSUPP || err == syscall.ENOTSUP || err == syscall.ENOSYS {
+			if fd.Fsync(nil, nil) == nil {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// DropCache commits the data in the range [offset, offset+length) to the
+// storage and then hints that the range won't be needed again, so it can be
+// dropped from the client cache. A length of 0 means up to the end of the
+// file.
+//
+// libgfapi has neither a ranged sync nor glfs_fadvise, so the whole file is
+// synced with Datasync and the DONTNEED hint is skipped until such a call
+// exists.
+//
+// Returns error on failure
+func (fd *Fd) DropCache(offset int64, length int64) error {
+	if offset < 0 || length < 0 {
+		return syscall.EINVAL
+	}
+	return fd.Datasync()
+}
+
+// Ftruncate truncates the size of the Fd to the given size. When the file
+// grows the new region is a hole which reads as zeros.
+//
+// Returns error on failure
+func (fd *Fd) Ftruncate(size int64, prestat, poststat *C.struct_glfs_stat) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+	if err := fd.checkWritable(); err != nil {
+		return err
+	}
+
+	ret, err := C.glfs_ftruncate(fd.fd, C.off_t(size), prestat, poststat)
+	fd.statChanged()
 	if ret < 0 {
 		return err
 	}
 	return nil
 }
 
-// Ftruncate truncates the size of the Fd to the given size
+// TruncateFunc truncates the size of the Fd to the given size and calls fn
+// with the stat of the file before and after the truncate, before returning.
+// fn is not called if the truncate fails.
+//
+// Returns error on failure
+func (fd *Fd) TruncateFunc(size int64, fn func(pre, post *Stat)) error {
+	var prestat, poststat C.struct_glfs_stat
+
+	if err := fd.Ftruncate(size, &prestat, &poststat); err != nil {
+		return err
+	}
+
+	fn(FromGlfsStat(&prestat), FromGlfsStat(&poststat))
+	return nil
+}
+
+// DirectIOAlignment is the alignment required for the offsets and lengths of
+// positional reads and writes on an Fd opened with O_DIRECT
+const DirectIOAlignment = 512
+
+// DirectIO reports whether the Fd was opened with O_DIRECT. Positional reads
+// and writes on such an Fd fail with EINVAL, without doing any I/O, when
+// their offset or length isn't a multiple of DirectIOAlignment.
+func (fd *Fd) DirectIO() bool {
+	return oDirect != 0 && fd.flags&oDirect != 0
+}
+
+// checkDirectIO returns EINVAL when the Fd was opened with O_DIRECT and off
+// or n aren't aligned to DirectIOAlignment
+func (fd *Fd) checkDirectIO(off int64, n int) error {
+	if fd.DirectIO() && (off%DirectIOAlignment != 0 || n%DirectIOAlignment != 0) {
+		return syscall.EINVAL
+	}
+	return nil
+}
+
+// Pread reads at most len(b) bytes into b from offset off in Fd.
+// See DirectIO for the alignment required on an Fd opened with O_DIRECT.
+//
+// Returns number of bytes read on success and error on failure
+func (fd *Fd) Pread(b []byte, off int64, poststat *C.struct_glfs_stat) (n int, err error) {
+	return fd.pread(b, off, 0, poststat)
+}
+
+// PreadFlags reads like Pread passing flags to glfs_pread. libgfapi defines no
+// read flags yet, the flags are passed down to the bricks as they are. The
+// metrics and logging apply as they do to Pread.
+//
+// Returns number of bytes read on success and error on failure
+func (fd *Fd) PreadFlags(b []byte, off int64, flags int) (int, error) {
+	return fd.pread(b, off, flags, nil)
+}
+
+func (fd *Fd) pread(b []byte, off int64, flags int, poststat *C.struct_glfs_stat) (n int, err error) {
+	if fd.fd == nil {
+		return 0, ErrClosed
+	}
+
+	if obs := loadMetricsObserver(); obs != nil {
+		defer observe(obs, "pread", time.Now(), &n, &err)
+	}
+	if l := loadLogger(); l != nil {
+		defer logOp(l, "pread", &n, &err, "len", len(b), "off", off)
+	}
+
+	if err := fd.checkDirectIO(off, len(b)); err != nil {
+		return 0, err
+	}
+
+	var p0 unsafe.Pointer
+
+	if len(b) > 0 {
+		p0 = unsafe.Pointer(&b[0])
+	} else {
+		p0 = unsafe.Pointer(&_zero)
+	}
+
+	return ignoringEINTR(func() (int, error) {
+		ret, err := C.glfs_pread(fd.fd, p0, C.size_t(len(b)), C.off_t(off), C.int(flags), poststat)
+		return int(ret), err
+	})
+}
+
+// ReadAtFull reads exactly len(b) bytes into b from offset off, issuing as
+// many Pread calls as needed. It mirrors io.ReadFull: the error is io.EOF
+// only if no bytes were read, and io.ErrUnexpectedEOF if the file ends after
+// some but not all the bytes were read.
+//
+// On an Fd opened with O_DIRECT a short read is taken as the end of the file:
+// the offset following it isn't aligned, so it can't be read again.
+//
+// Returns number of bytes read and an error if fewer than len(b) bytes were read
+func (fd *Fd) ReadAtFull(b []byte, off int64) (n int, err error) {
+	for n < len(b) {
+		m, err := fd.Pread(b[n:], off+int64(n), nil)
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, io.ErrUnexpectedEOF
+		}
+		n += m
+		if n < len(b) && fd.DirectIO() {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, nil
+}
+
+// ReadAt reads len(b) bytes into b from offset off, implementing
+// io.ReaderAt. It doesn't use the offset of the Fd, so it is safe to call
+// concurrently. File.ReadAt takes an extra Stat, use the Fd of a File for an
+// io.ReaderAt.
+//
+// A zero-byte pread with a non-empty b means the end of the file was reached,
+// so reading at or past the end returns 0 and io.EOF, and reading across the
+// end returns the bytes before it and io.EOF, as io.ReaderAt requires.
+//
+// Returns number of bytes read and an error if fewer than len(b) bytes were
+// read, io.EOF if the file ended first
+func (fd *Fd) ReadAt(b []byte, off int64) (int, error) {
+	n, err := fd.ReadAtFull(b, off)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// ReadAllCapped returns the whole contents of the file, for small files like
+// configuration files. The size of the file is taken from an Fstat, so the
+// buffer is allocated once with the right size, and the file is read from its
+// beginning with ReadAtFull. The offset of the Fd is left untouched.
+//
+// Returns ErrTooLarge, without reading anything, if the file is larger than
+// limit bytes. If the file shrinks while being read the bytes read are returned
+// along with an error wrapping io.ErrUnexpectedEOF.
+func (fd *Fd) ReadAllCapped(limit int64) ([]byte, error) {
+	if limit < 0 {
+		return nil, syscall.EINVAL
+	}
+
+	size, err := fd.Size()
+	if err != nil {
+		return nil, err
+	}
+	if size > limit {
+		return nil, fmt.Errorf("file size %d exceeds %d bytes: %w", size, limit, ErrTooLarge)
+	}
+
+	buf := make([]byte, size)
+	n, err := fd.ReadAtFull(buf, 0)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return buf[:n], fmt.Errorf("read %d bytes of a file of %d bytes: %w", n, size, io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return buf[:n], err
+	}
+	return buf, nil
+}
+
+// Section returns an io.SectionReader reading the n bytes of the Fd from
+// offset off. It reads with ReadAt, so many sections of the same Fd can be
+// read concurrently.
+func (fd *Fd) Section(off, n int64) *io.SectionReader {
+	return io.NewSectionReader(fd, off, n)
+}
+
+// ReaderAtReader returns an io.Reader reading the Fd from its beginning with
+// its own offset. It reads with ReadAt and doesn't touch the offset of the
+// Fd, so many readers can stream the same Fd concurrently without a glfs_dup.
+func (fd *Fd) ReaderAtReader() io.Reader {
+	return io.NewSectionReader(fd, 0, math.MaxInt64)
+}
+
+// Pwrite writes len(b) bytes from b into the Fd from offset off. Writing past
+// the end of the file leaves a hole between the old end and off.
+// See DirectIO for the alignment required on an Fd opened with O_DIRECT.
+//
+// As with pwrite(2) on Linux, off is ignored when the Fd was opened with
+// O_APPEND: the bytes are always written at the end of the file. The same goes
+// for the helpers built on Pwrite, like PwriteSync and File.WriteAt.
+//
+// Returns number of bytes written on success and error on failure
+func (fd *Fd) Pwrite(b []byte, off int64, prestat, poststat *C.struct_glfs_stat) (n int, err error) {
+	return fd.pwrite(b, off, 0, prestat, poststat)
+}
+
+// PwriteFlags writes like Pwrite passing flags to glfs_pwrite, see WriteSync
+// and WriteDsync. The metrics and logging apply as they do to Pwrite.
+//
+// Returns number of bytes written on success and error on failure
+func (fd *Fd) PwriteFlags(b []byte, off int64, flags int) (int, error) {
+	return fd.pwrite(b, off, flags, nil, nil)
+}
+
+func (fd *Fd) pwrite(b []byte, off int64, flags int, prestat, poststat *C.struct_glfs_stat) (n int, err error) {
+	if fd.fd == nil {
+		return 0, ErrClosed
+	}
+	if err := fd.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	if obs := loadMetricsObserver(); obs != nil {
+		defer observe(obs, "pwrite", time.Now(), &n, &err)
+	}
+	if l := loadLogger(); l != nil {
+		defer logOp(l, "pwrite", &n, &err, "len", len(b), "off", off)
+	}
+
+	if err := fd.checkDirectIO(off, len(b)); err != nil {
+		return 0, err
+	}
+
+	var p0 unsafe.Pointer
+
+	if len(b) > 0 {
+		p0 = unsafe.Pointer(&b[0])
+	} else {
+		p0 = unsafe.Pointer(&_zero)
+	}
+
+	return ignoringEINTR(func() (int, error) {
+		ret, err := C.glfs_pwrite(fd.fd, p0, C.size_t(len(b)), C.off_t(off), C.int(flags), prestat, poststat)
+		fd.statChanged()
+		return int(ret), err
+	})
+}
+
+// WriteAt writes len(b) bytes from b into the Fd at offset off, implementing
+// io.WriterAt. A single glfs_pwrite may write fewer bytes than asked, so
+// WriteAt keeps writing the rest of b at the following offsets until all of b
+// has been written. It doesn't use the offset of the Fd. File.WriteAt takes
+// extra Stats, use the Fd of a File for an io.WriterAt.
+//
+// Returns number of bytes written and error on failure. The error is non-nil
+// whenever fewer than len(b) bytes were written, io.ErrShortWrite if a write
+// made no progress.
+func (fd *Fd) WriteAt(b []byte, off int64) (int, error) {
+	return fd.pwriteFull(b, off)
+}
+
+// pwriteFull calls Pwrite until all of b has been written at offset off or an
+// error occurs. io.ErrShortWrite is returned if a write makes no progress.
+func (fd *Fd) pwriteFull(b []byte, off int64) (n int, err error) {
+	return writeAtFull(func(b []byte, off int64) (int, error) {
+		return fd.Pwrite(b, off, nil, nil)
+	}, b, off)
+}
+
+// writeAtFull calls writeAt until all of b has been written at offset off or
+// an error occurs. io.ErrShortWrite is returned if a write makes no progress.
+func writeAtFull(writeAt func(b []byte, off int64) (int, error), b []byte, off int64) (n int, err error) {
+	if len(b) == 0 {
+		return writeAt(b, off)
+	}
+
+	for n < len(b) {
+		m, err := writeAt(b[n:], off+int64(n))
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrShortWrite
+		}
+		n += m
+	}
+
+	return n, nil
+}
+
+// PwriteSync writes all of b into the Fd from offset off and then waits for
+// the data to reach the storage with Datasync, so the write is durable when
+// PwriteSync returns. Each call waits for a round trip to the bricks' disks,
+// which is orders of magnitude slower than a plain Pwrite, batch writes when
+// durability is only needed at some points.
+//
+// Returns number of bytes written and error on failure. When the sync fails
+// the bytes were written but may not be durable.
+func (fd *Fd) PwriteSync(b []byte, off int64) (int, error) {
+	n, err := fd.pwriteFull(b, off)
+	if err != nil {
+		return n, err
+	}
+	return n, fd.Datasync()
+}
+
+// Read reads at most len(b) bytes into b from Fd
+//
+// Returns number of bytes read on success and error on failure
+func (fd *Fd) Read(b []byte) (n int, err error) {
+	return fd.ReadFlags(b, 0)
+}
+
+// ReadFlags reads like Read passing flags to glfs_read. libgfapi defines no
+// read flags yet, the flags are passed down to the bricks as they are. The
+// read deadline, metrics and logging apply as they do to Read.
+//
+// Returns number of bytes read on success and error on failure
+func (fd *Fd) ReadFlags(b []byte, flags int) (n int, err error) {
+	if fd.fd == nil {
+		return 0, ErrClosed
+	}
+
+	if obs := loadMetricsObserver(); obs != nil {
+		defer observe(obs, "read", time.Now(), &n, &err)
+	}
+	if l := loadLogger(); l != nil {
+		defer logOp(l, "read", &n, &err, "len", len(b))
+	}
+
+	if deadline := fd.readDeadline.Load(); deadline != 0 {
+		return fd.withDeadline(deadline, b, false, func(cfd *C.glfs_fd_t, b []byte) (int, error) {
+			return fd.read(cfd, b, flags)
+		})
+	}
+	return fd.read(fd.fd, b, flags)
+}
+
+// ReadN reads exactly len(b) bytes into b from the Fd, issuing as many reads
+// as needed. It mirrors io.ReadFull: the error is io.EOF only if no bytes were
+// read, and io.ErrUnexpectedEOF if the file ends after some but not all the
+// bytes were read.
+//
+// Returns number of bytes read and an error if fewer than len(b) bytes were read
+func (fd *Fd) ReadN(b []byte) (n int, err error) {
+	for n < len(b) {
+		m, err := fd.Read(b[n:])
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, io.ErrUnexpectedEOF
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// read issues a single glfs_read on cfd, the glfd of the Fd, retrying when
+// interrupted
+func (fd *Fd) read(cfd *C.glfs_fd_t, b []byte, flags int) (n int, err error) {
+	var p0 unsafe.Pointer
+
+	if len(b) > 0 {
+		p0 = unsafe.Pointer(&b[0])
+	} else {
+		p0 = unsafe.Pointer(&_zero)
+	}
+
+	// glfs_read returns a ssize_t. The value of which is the number of bytes written.
+	// Unless, ret is -1, an error, implying to check errno. cgo collects errno as the
+	// functions error return value.
+	return ignoringEINTR(func() (int, error) {
+		ret, err := C.glfs_read(cfd, p0, C.size_t(len(b)), C.int(flags))
+		return int(ret), err
+	})
+}
+
+// Write writes len(b) bytes from b into the Fd. Write keeps issuing writes
+// until all of b has been written, so unlike a single glfs_write it never
+// silently returns a short count.
+//
+// Returns number of bytes written on success and error on failure. The error
+// is non-nil whenever fewer than len(b) bytes were written.
+func (fd *Fd) Write(b []byte) (n int, err error) {
+	return fd.WriteFlags(b, 0)
+}
+
+// Flags of WriteFlags and PwriteFlags, the open flags O_SYNC and O_DSYNC. The
+// bricks sync the written data, and for WriteSync the metadata, before the
+// write returns, as if the file had been opened with them.
+const (
+	WriteSync  = O_SYNC
+	WriteDsync = O_DSYNC
+)
+
+// WriteFlags writes like Write passing flags to glfs_write, see WriteSync and
+// WriteDsync. The write deadline, metrics and logging apply as they do to
+// Write.
+//
+// Returns number of bytes written on success and error on failure. The error
+// is non-nil whenever fewer than len(b) bytes were written.
+func (fd *Fd) WriteFlags(b []byte, flags int) (n int, err error) {
+	if obs := loadMetricsObserver(); obs != nil {
+		defer observe(obs, "write", time.Now(), &n, &err)
+	}
+	if l := loadLogger(); l != nil {
+		defer logOp(l, "write", &n, &err, "len", len(b))
+	}
+
+	if deadline := fd.writeDeadline.Load(); deadline != 0 {
+		return fd.withDeadline(deadline, b, true, func(cfd *C.glfs_fd_t, b []byte) (int, error) {
+			return fd.writeFull(cfd, b, flags)
+		})
+	}
+	return fd.writeFull(fd.fd, b, flags)
+}
+
+// Fd implements io.ReaderAt and io.WriterAt, whose calls don't use the offset
+// of the Fd
+var (
+	_ io.ReaderAt = (*Fd)(nil)
+	_ io.WriterAt = (*Fd)(nil)
+)
+
+// Fd implements io.StringWriter, which fmt.Fprint and io.WriteString use to
+// avoid converting strings
+var _ io.StringWriter = (*Fd)(nil)
+
+// WriteString writes the contents of string s into the Fd, with the same
+// full-write guarantee as Write. s is passed to glfs_write without being
+// copied, cgo keeps its memory pinned for the duration of the call.
+//
+// Returns number of bytes written on success and error on failure
+func (fd *Fd) WriteString(s string) (int, error) {
+	return fd.Write(stringBytes(s))
+}
+
+// stringBytes returns a read-only view of the bytes of s without copying them.
+// The returned slice must never be modified.
+func stringBytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// DefaultCopyBufferSize is the size of the buffer used by the streaming
+// helpers (WriteToN, SpliceTo, ...) when the preferred I/O size of the file
+// isn't known, the same as the default gluster I/O block size.
+// MinCopyBufferSize is the smallest size accepted by SetCopyBufferSize.
+const (
+	DefaultCopyBufferSize = 128 << 10
+	MinCopyBufferSize     = 4 << 10
+)
+
+// SetCopyBufferSize sets the size of the buffer allocated by each call of the
+// streaming helpers (WriteToN, SpliceTo, ...) on the Fd, to bound their
+// memory use. A size of 0 restores the default, which is
+// DefaultCopyBufferSize rounded down to a multiple of the preferred I/O size
+// of the file.
+//
+// Returns error if size is neither 0 nor at least MinCopyBufferSize
+func (fd *Fd) SetCopyBufferSize(size int64) error {
+	if size != 0 && size < MinCopyBufferSize {
+		return fmt.Errorf("copy buffer size %d is smaller than %d", size, MinCopyBufferSize)
+	}
+	fd.copyBufSize = size
+	return nil
+}
+
+// copyBufferSize returns the size of the buffer to be used by the streaming
+// helpers
+func (fd *Fd) copyBufferSize() (int64, error) {
+	if fd.copyBufSize > 0 {
+		return fd.copyBufSize, nil
+	}
+
+	var stat syscall.Stat_t
+	if err := fd.Fstat(&stat); err != nil {
+		return 0, err
+	}
+	return alignedBufferSize(int64(stat.Blksize)), nil
+}
+
+// alignedBufferSize returns DefaultCopyBufferSize rounded down to a multiple
+// of blksize, and at least blksize
+func alignedBufferSize(blksize int64) int64 {
+	if blksize <= 0 {
+		return DefaultCopyBufferSize
+	}
+	if blksize >= DefaultCopyBufferSize {
+		return blksize
+	}
+	return DefaultCopyBufferSize / blksize * blksize
+}
+
+// WriteToN writes at most n bytes read from the current offset of the Fd to
+// w. It stops early, without an error, when the end of the file is reached.
+//
+// Returns number of bytes written on success and error on failure
+func (fd *Fd) WriteToN(w io.Writer, n int64) (written int64, err error) {
+	size, err := fd.copyBufferSize()
+	if err != nil {
+		return 0, err
+	}
+	return fd.copyN(w, n, size)
+}
+
+// SpliceTo copies at most length bytes read from the current offset of the Fd
+// to dst. It stops early, without an error, when the end of the file is
+// reached.
+//
+// The copy goes through a single buffer, by default sized to a multiple of
+// the preferred I/O size of the file, as no kernel splice is possible across
+// libgfapi.
+//
+// Returns number of bytes copied on success and error on failure
+func (fd *Fd) SpliceTo(dst *os.File, length int64) (int64, error) {
+	size, err := fd.copyBufferSize()
+	if err != nil {
+		return 0, err
+	}
+	return fd.copyN(dst, length, size)
+}
+
+// copyN copies at most n bytes from the current offset of the Fd to w, using
+// a buffer of at most size bytes
+func (fd *Fd) copyN(w io.Writer, n int64, size int64) (written int64, err error) {
+	if n < size {
+		size = n
+	}
+	if size <= 0 {
+		return 0, nil
+	}
+	buf := make([]byte, size)
+
+	for written < n {
+		chunk := buf
+		if rem := n - written; rem < int64(len(chunk)) {
+			chunk = chunk[:rem]
+		}
+
+		nr, err := fd.Read(chunk)
+		if err != nil {
+			return written, err
+		}
+		if nr == 0 {
+			break
+		}
+
+		nw, err := w.Write(chunk[:nr])
+		written += int64(nw)
+		if err != nil {
+			return written, err
+		}
+		if nw != nr {
+			return written, io.ErrShortWrite
+		}
+	}
+
+	return written, nil
+}
+
+// Checksum feeds the length bytes of the Fd from offset off into h, reading
+// them with ReadAt in chunks of the copy buffer size. A length of 0 means up to
+// the end of the file. The sum is left in h, to be read with h.Sum.
+//
+// Returns number of bytes hashed, which is less than length if the file ends
+// first, and error on failure
+func (fd *Fd) Checksum(h hash.Hash, off int64, length int64) (int64, error) {
+	if off < 0 || length < 0 {
+		return 0, syscall.EINVAL
+	}
+	if length == 0 {
+		length = math.MaxInt64 - off
+	}
+
+	return fd.ExtractRange(h, off, length)
+}
+
+// ExtractRange writes the n bytes of the Fd from offset off to w, reading
+// them with ReadAt in chunks of the copy buffer size. It stops early, without
+// an error, when the end of the file is reached. It doesn't use the offset of
+// the Fd, so ranges of the same Fd can be extracted concurrently.
+//
+// Returns number of bytes written and error on failure
+func (fd *Fd) ExtractRange(w io.Writer, off int64, n int64) (written int64, err error) {
+	if off < 0 || n < 0 {
+		return 0, syscall.EINVAL
+	}
+
+	size, err := fd.copyBufferSize()
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, min(size, max(n, 1)))
+	for written < n {
+		m, rerr := fd.ReadAt(buf[:min(int64(len(buf)), n-written)], off+written)
+		if m > 0 {
+			wm, werr := w.Write(buf[:m])
+			written += int64(wm)
+			if werr != nil {
+				return written, werr
+			}
+			if wm != m {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+	return written, nil
+}
+
+// Append writes len(b) bytes from b at the end of the file.
+//
+// If the Fd was opened with O_APPEND each write is positioned at the end of
+// the file atomically. Otherwise Append seeks to the end and writes while
+// holding the Fd's lock. This only serializes appends made through the same
+// Fd and is not atomic against other writers of the file.
+//
+// Returns number of bytes written on success and error on failure
+func (fd *Fd) Append(b []byte) (int, error) {
+	if fd.fd == nil {
+		return 0, ErrClosed
+	}
+
+	if fd.flags&os.O_APPEND != 0 {
+		return fd.Write(b)
+	}
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	if _, err := fd.Seek(0, SeekEnd); err != nil {
+		return 0, err
+	}
+	return fd.Write(b)
+}
+
+// writeFull calls write on cfd, the glfd of the Fd, until all of b has been
+// written or an error occurs. io.ErrShortWrite is returned if a write makes no
+// progress.
+func (fd *Fd) writeFull(cfd *C.glfs_fd_t, b []byte, flags int) (n int, err error) {
+	if len(b) == 0 {
+		return fd.write(cfd, b, flags)
+	}
+
+	for n < len(b) {
+		m, err := fd.write(cfd, b[n:], flags)
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrShortWrite
+		}
+		n += m
+	}
+
+	return n, nil
+}
+
+// write performs a single glfs_write on cfd, the glfd of the Fd, retrying
+// when interrupted
+func (fd *Fd) write(cfd *C.glfs_fd_t, b []byte, flags int) (n int, err error) {
+	if cfd == nil {
+		return 0, ErrClosed
+	}
+	if err := fd.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	var p0 unsafe.Pointer
+
+	if len(b) > 0 {
+		p0 = unsafe.Pointer(&b[0])
+	} else {
+		p0 = unsafe.Pointer(&_zero)
+	}
+
+	// glfs_write returns a ssize_t. The value of which is the number of bytes written.
+	// Unless, ret is -1, an error, implying to check errno. cgo collects errno as the
+	// functions error return value.
+	return ignoringEINTR(func() (int, error) {
+		ret, err := C.glfs_write(cfd, p0, C.size_t(len(b)), C.int(flags))
+		fd.statChanged()
+		return int(ret), err
+	})
+}
+
+// SeekStart, SeekCurrent and SeekEnd are the whence values of Seek, the same
+// as io.SeekStart, io.SeekCurrent and io.SeekEnd
+const (
+	SeekStart   = io.SeekStart
+	SeekCurrent = io.SeekCurrent
+	SeekEnd     = io.SeekEnd
+)
+
+// Seek sets the offset for the next Read or Write on the Fd to offset,
+// interpreted according to whence: SeekStart means relative to the start of
+// the file, SeekCurrent means relative to the current offset, and SeekEnd
+// means relative to the end. SeekData and SeekHole are also accepted.
+//
+// Returns the new offset on success and error on failure
+func (fd *Fd) Seek(offset int64, whence int) (int64, error) {
+	if fd.fd == nil {
+		return -1, ErrClosed
+	}
+
+	ret, err := C.glfs_lseek(fd.fd, C.off_t(offset), C.int(whence))
+	if ret < 0 {
+		return -1, err
+	}
+	return int64(ret), nil
+}
+
+// Offset returns the current offset of the Fd without changing it
+//
+// Returns the offset on success and error on failure
+func (fd *Fd) Offset() (int64, error) {
+	if fd.fd == nil {
+		return -1, ErrClosed
+	}
+
+	ret, err := C.glfs_lseek(fd.fd, 0, C.int(SeekCurrent))
+	if ret < 0 {
+		return -1, err
+	}
+	return int64(ret), nil
+}
+
+// Remaining returns the number of bytes between the current offset of the Fd
+// and the end of the file, 0 when the offset is past the end. The size comes
+// from an Fstat and the offset from Offset, so the offset isn't changed.
+//
+// Returns error on failure
+func (fd *Fd) Remaining() (int64, error) {
+	size, err := fd.Size()
+	if err != nil {
+		return 0, err
+	}
+	off, err := fd.Offset()
+	if err != nil {
+		return 0, err
+	}
+	return max(size-off, 0), nil
+}
+
+// SeekData sets the offset of the Fd to the start of the next region
+// containing data at or after off
+//
+// Returns the new offset on success and error on failure. ErrSeekNotSupported
+// is returned if the volume doesn't support SEEK_DATA.
+func (fd *Fd) SeekData(off int64) (int64, error) {
+	return fd.seekSparse(off, SeekData)
+}
+
+// SeekHole sets the offset of the Fd to the start of the next hole at or
+// after off. The end of the file is considered a hole.
+//
+// Returns the new offset on success and error on failure. ErrSeekNotSupported
+// is returned if the volume doesn't support SEEK_HOLE.
+func (fd *Fd) SeekHole(off int64) (int64, error) {
+	return fd.seekSparse(off, SeekHole)
+}
+
+func (fd *Fd) seekSparse(off int64, whence int) (int64, error) {
+	if fd.fd == nil {
+		return -1, ErrClosed
+	}
+
+	if off < 0 {
+		return -1, syscall.EINVAL
+	}
+
+	ret, err := C.glfs_lseek(fd.fd, C.off_t(off), C.int(whence))
+	if ret < 0 {
+		// An unknown whence is reported as EINVAL, the offset has been checked above
+		if err == syscall.EINVAL || err == syscall.ENOTSUP ||
+			err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+			return -1, ErrSeekNotSupported
+		}
+		return -1, err
+	}
+	return int64(ret), nil
+}
+
+// CopySparse copies the first length bytes of the Fd to the same offsets of
+// dst, preserving the holes. The data regions are found with SeekData and
+// SeekHole and only they are written, so the holes of the Fd stay holes in
+// dst provided dst has no data there already. dst is then extended to length
+// if needed, leaving a trailing hole. A length past the end of the Fd is
+// capped to its size, like the copy stops at the end of the file. The offset
+// of the Fd is changed.
+//
+// When the volume doesn't support finding holes the whole range is copied,
+// writing the holes as zeros, and the fallback is reported to the Logger if
+// one is set.
+//
+// Returns error on failure
+func (fd *Fd) CopySparse(dst *Fd, length int64) error {
+	if fd.fd == nil || dst.fd == nil {
+		return ErrClosed
+	}
+
+	var stat syscall.Stat_t
+	if err := fd.Fstat(&stat); err != nil {
+		return err
+	}
+	length = min(length, stat.Size)
+
+	size, err := fd.copyBufferSize()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, size)
+
+	for off := int64(0); off < length; {
+		data, err := fd.SeekData(off)
+		if err == ErrSeekNotSupported {
+			if l := loadLogger(); l != nil {
+				l.Logf("gfapi: op=copysparse %v, copying holes as zeros", err)
+			}
+			return fd.copyRange(dst, buf, off, length)
+		}
+		if err == syscall.ENXIO || (err == nil && data >= length) {
+			// Only a hole is left
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		hole, err := fd.SeekHole(data)
+		if err != nil {
+			return err
+		}
+		end := min(hole, length)
+		if err := fd.copyRange(dst, buf, data, end); err != nil {
+			return err
+		}
+		off = end
+	}
+
+	dstSize, err := dst.Size()
+	if err != nil {
+		return err
+	}
+	if dstSize < length {
+		return dst.Ftruncate(length, nil, nil)
+	}
+	return nil
+}
+
+// ReplaceContents replaces the contents of the Fd with all the bytes of src,
+// read from its beginning. The Fd is truncated to zero, the bytes are copied
+// at the same offsets and the Fd is then synced with Datasync.
+//
+// The replacement is not atomic: readers may see an empty or partially
+// copied file, and a crash leaves the file in that state. Writing a new file
+// and renaming it over the old one with Volume.Rename is needed for that.
+//
+// Returns error on failure
+func (fd *Fd) ReplaceContents(src *Fd) error {
+	if fd.fd == nil || src.fd == nil {
+		return ErrClosed
+	}
+
+	size, err := src.copyBufferSize()
+	if err != nil {
+		return err
+	}
+
+	if err := fd.Ftruncate(0, nil, nil); err != nil {
+		return err
+	}
+	if err := src.copyRange(fd, make([]byte, size), 0, math.MaxInt64); err != nil {
+		return err
+	}
+	return fd.Datasync()
+}
+
+// ReplaceAll replaces the contents of the Fd with b: the Fd is truncated to
+// zero, all of b is written from offset 0 and the Fd is then synced with
+// Datasync, so the new contents are durable when ReplaceAll returns.
+//
+// Like ReplaceContents the replacement is not atomic, readers may see an
+// empty or partially written file. Writing a new file and renaming it over the
+// old one with Volume.Rename is needed for that.
+//
+// Returns error on failure
+func (fd *Fd) ReplaceAll(b []byte) error {
+	if err := fd.Ftruncate(0, nil, nil); err != nil {
+		return err
+	}
+	if len(b) > 0 {
+		if _, err := fd.pwriteFull(b, 0); err != nil {
+			return err
+		}
+	}
+	return fd.Datasync()
+}
+
+// copyRange copies the bytes of the Fd from offset off up to end to the same
+// offsets of dst through buf, stopping early at the end of the file
+func (fd *Fd) copyRange(dst *Fd, buf []byte, off, end int64) error {
+	for off < end {
+		n, err := fd.ReadAt(buf[:min(int64(len(buf)), end-off)], off)
+		if n > 0 {
+			if _, werr := dst.pwriteFull(buf[:n], off); werr != nil {
+				return werr
+			}
+			off += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetReadAhead hints that the next bytes bytes after the current offset
+// will be read sequentially.
+//
+// libgfapi has no per-fd readahead tunable nor glfs_fadvise, readahead is
+// configured per volume with the performance.read-ahead options. Until such
+// a call exists SetReadAhead is a no-op which returns nil.
 //
 // Returns error on failure
-func (fd *Fd) Ftruncate(size int64, prestat, poststat *C.struct_glfs_stat) error {
-	_, err := C.glfs_ftruncate(fd.fd, C.off_t(size), prestat, poststat)
-
-	return err
+func (fd *Fd) SetReadAhead(bytes int64) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+	if bytes < 0 {
+		return syscall.EINVAL
+	}
+	return nil
 }
 
-// Pread reads at most len(b) bytes into b from offset off in Fd
-//
-// Returns number of bytes read on success and error on failure
-func (fd *Fd) Pread(b []byte, off int64, poststat *C.struct_glfs_stat) (int, error) {
-	n, err := C.glfs_pread(fd.fd, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.off_t(off), 0, poststat)
+func (fd *Fd) Fallocate(mode int, offset int64, len int64) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+	if err := fd.checkWritable(); err != nil {
+		return err
+	}
+
+	ret, err := C.glfs_fallocate(fd.fd, C.int(mode),
+		C.off_t(offset), C.size_t(len))
+	fd.statChanged()
 
-	return int(n), err
+	if ret == 0 {
+		err = nil
+	}
+	return err
 }
 
-// Pwrite writes len(b) bytes from b into the Fd from offset off
+// ExtendAllocated changes the size of the file to size. When the file grows
+// the new region is allocated with Fallocate instead of being left as a hole,
+// so later writes to it can't fail with ENOSPC. When the file shrinks it is
+// simply truncated.
 //
-// Returns number of bytes written on success and error on failure
-func (fd *Fd) Pwrite(b []byte, off int64, prestat, poststat *C.struct_glfs_stat) (int, error) {
-	n, err := C.glfs_pwrite(fd.fd, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.off_t(off), 0, prestat, poststat)
+// Returns error on failure
+func (fd *Fd) ExtendAllocated(size int64) error {
+	cur, err := fd.Size()
+	if err != nil {
+		return err
+	}
 
-	return int(n), err
+	if size <= cur {
+		if size == cur {
+			return nil
+		}
+		return fd.Ftruncate(size, nil, nil)
+	}
+	return fd.Fallocate(0, cur, size-cur)
 }
 
-// Read reads at most len(b) bytes into b from Fd
+// AllocateAndVerify preallocates the first size bytes of the file with
+// Fallocate and then reports, from an Fstat, the number of 512-byte blocks
+// allocated to the file. Some backends accept the fallocate without reserving
+// anything, comparing the count to the expected one, size/512 rounded up,
+// detects such a silent no-op.
 //
-// Returns number of bytes read on success and error on failure
-func (fd *Fd) Read(b []byte) (n int, err error) {
-	var p0 unsafe.Pointer
-
-	if len(b) > 0 {
-		p0 = unsafe.Pointer(&b[0])
-	} else {
-		p0 = unsafe.Pointer(&_zero)
+// Returns the number of blocks allocated and error on failure
+func (fd *Fd) AllocateAndVerify(size int64) (blocksAllocated uint64, err error) {
+	if size < 0 {
+		return 0, syscall.EINVAL
 	}
-
-	// glfs_read returns a ssize_t. The value of which is the number of bytes written.
-	// Unless, ret is -1, an error, implying to check errno. cgo collects errno as the
-	// functions error return value.
-	ret, e1 := C.glfs_read(fd.fd, p0, C.size_t(len(b)), 0)
-	n = int(ret)
-	if n < 0 {
-		err = e1
+	if err := fd.Fallocate(0, 0, size); err != nil {
+		return 0, err
 	}
 
-	return n, err
+	var stat syscall.Stat_t
+	if err := fd.Fstat(&stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Blocks), nil
 }
 
-// Write writes len(b) bytes from b into the Fd
+// EnsureAllocated makes sure the length bytes from offset are allocated, so
+// later writes to them can't fail with ENOSPC. It uses Fallocate and, when
+// the volume doesn't support it, falls back to writing the range in chunks
+// of the copy buffer size: the existing bytes are written back as they are
+// and the bytes past the end of the file are written as zeros, with a single
+// glfs_zerofill when Capabilities reports it. The fallback isn't atomic,
+// concurrent writes to the range may be overwritten.
 //
-// Returns number of bytes written on success and error on failure
-func (fd *Fd) Write(b []byte) (n int, err error) {
-	var p0 unsafe.Pointer
-
-	if len(b) > 0 {
-		p0 = unsafe.Pointer(&b[0])
-	} else {
-		p0 = unsafe.Pointer(&_zero)
+// Returns error on failure
+func (fd *Fd) EnsureAllocated(offset int64, length int64) error {
+	if offset < 0 || length < 0 {
+		return syscall.EINVAL
 	}
 
-	// glfs_write returns a ssize_t. The value of which is the number of bytes written.
-	// Unless, ret is -1, an error, implying to check errno. cgo collects errno as the
-	// functions error return value.
-	ret, e1 := C.glfs_write(fd.fd, p0, C.size_t(len(b)), 0)
-	n = int(ret)
-	if n < 0 {
-		err = e1
+	err := fd.Fallocate(0, offset, length)
+	if err != syscall.EOPNOTSUPP && err != syscall.ENOTSUP {
+		return err
 	}
 
-	return n, err
-}
-
-func (fd *Fd) lseek(offset int64, whence int) (int64, error) {
-	ret, err := C.glfs_lseek(fd.fd, C.off_t(offset), C.int(whence))
+	end := offset + length
+	if Capabilities().Zerofill {
+		cur, err := fd.Size()
+		if err != nil {
+			return err
+		}
+		// Only the bytes past the end of the file are zeros
+		if start := max(offset, cur); start < end && fd.zerofill(start, end-start) == nil {
+			end = start
+		}
+	}
 
-	return int64(ret), err
-}
+	size, err := fd.copyBufferSize()
+	if err != nil {
+		return err
+	}
 
-func (fd *Fd) Fallocate(mode int, offset int64, len int64) error {
-	ret, err := C.glfs_fallocate(fd.fd, C.int(mode),
-		C.off_t(offset), C.size_t(len))
+	buf := make([]byte, size)
+	for offset < end {
+		chunk := buf[:min(size, end-offset)]
+		n, err := fd.ReadAt(chunk, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		clear(chunk[n:])
 
-	if ret == 0 {
-		err = nil
+		m, err := fd.pwriteFull(chunk, offset)
+		if err != nil {
+			return err
+		}
+		offset += int64(m)
 	}
-	return err
+	return nil
 }
 
 func (fd *Fd) Fgetxattr(attr string, dest []byte) (int64, error) {
+	if fd.fd == nil {
+		return -1, ErrClosed
+	}
+
 	var ret C.ssize_t
 	var err error
 
@@ -240,6 +1696,9 @@ func (fd *Fd) Fgetxattr(attr string, dest []byte) (int64, error) {
 }
 
 func (fd *Fd) Fsetxattr(attr string, data []byte, flags int) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
 
 	cattr := C.CString(attr)
 	defer C.free(unsafe.Pointer(cattr))
@@ -255,6 +1714,9 @@ func (fd *Fd) Fsetxattr(attr string, data []byte, flags int) error {
 }
 
 func (fd *Fd) Fremovexattr(attr string) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
 
 	cattr := C.CString(attr)
 	defer C.free(unsafe.Pointer(cattr))
@@ -267,6 +1729,32 @@ func (fd *Fd) Fremovexattr(attr string) error {
 	return err
 }
 
+// Flistxattr places the names of the extended attributes of the Fd in dest,
+// each one terminated by a NUL byte. An empty dest only returns the length of
+// the names.
+//
+// Returns number of bytes placed in dest and error if any
+func (fd *Fd) Flistxattr(dest []byte) (int64, error) {
+	if fd.fd == nil {
+		return -1, ErrClosed
+	}
+
+	var ret C.ssize_t
+	var err error
+
+	if len(dest) <= 0 {
+		ret, err = C.glfs_flistxattr(fd.fd, nil, 0)
+	} else {
+		ret, err = C.glfs_flistxattr(fd.fd,
+			unsafe.Pointer(&dest[0]), C.size_t(len(dest)))
+	}
+
+	if ret < 0 {
+		return int64(ret), err
+	}
+	return int64(ret), nil
+}
+
 func direntName(dirent *syscall.Dirent) string {
 	name := make([]byte, 0, len(dirent.Name))
 	for i, c := range dirent.Name {
@@ -285,17 +1773,246 @@ func direntName(dirent *syscall.Dirent) string {
 // n is the maximum number of items to return. If there are more items than
 // the maximum they can be obtained in successive calls. If maximum is 0
 // then all the items will be returned.
-func (fd *Fd) Readdir(n int) ([]os.FileInfo, error) {
+//
+// If an error occurs partway through the directory, the items read so far
+// are returned along with the error, like os.File.Readdir does.
+//
+// The entries are not followed: a symlink is reported with os.ModeSymlink
+// and the size of the link itself, the length of its target.
+//
+// Each returned os.FileInfo owns a copy of its name and stat, none of them
+// aliases the buffers reused while reading the directory. Readdir on different
+// Fds can run concurrently, concurrent calls on the same Fd are unsupported as
+// they share the position in the directory.
+//
+// The Sys method of each returned os.FileInfo returns a *syscall.Stat_t.
+func (fd *Fd) Readdir(n int) (files []os.FileInfo, err error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+
+	if obs := loadMetricsObserver(); obs != nil {
+		defer observe(obs, "readdir", time.Now(), nil, &err)
+	}
+	if l := loadLogger(); l != nil {
+		defer logOp(l, "readdir", nil, &err, "n", n)
+	}
+
+	err = fd.readdirplus(n, func(name string, stat *syscall.Stat_t) error {
+		files = append(files, fileInfoFromStat(stat, name))
+		return nil
+	})
+	if err != nil {
+		return files, err
+	}
+
+	return files, nil
+}
+
+// ReaddirContext returns the information of files in a directory like
+// Readdir, checking ctx after each entry so that the listing of a huge
+// directory can be abandoned, e.g. when the client of a server goes away.
+//
+// n is the maximum number of items to return and works the same way as Readdir.
+//
+// Returns the entries read so far along with ctx.Err() when ctx is done
+func (fd *Fd) ReaddirContext(ctx context.Context, n int) (files []os.FileInfo, err error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	err = fd.readdirplus(n, func(name string, stat *syscall.Stat_t) error {
+		files = append(files, fileInfoFromStat(stat, name))
+		return ctx.Err()
+	})
+	return files, err
+}
+
+// SkipEntry is returned by the function passed to ReaddirFunc to skip an
+// entry without stopping the listing
+var SkipEntry = errors.New("skip this directory entry")
+
+// ReaddirFunc calls fn with the information of each of the remaining entries
+// of the directory, in directory order. When fn returns an error the listing
+// stops and the error is returned, unless it is SkipEntry or wraps it, in
+// which case the entry is skipped and the listing goes on. A fn which needs
+// more than the stat of an entry, like opening it, can thus skip the entries
+// removed meanwhile in a churning directory instead of failing the scan.
+//
+// SkipEntry only covers the errors of fn. A failure of glfs_readdirplus itself
+// can't be skipped: it doesn't tell which entry failed nor whether the
+// directory stream moved past it, so it ends the listing and is returned, and
+// the entries already passed to fn are not listed again.
+//
+// The Sys method of each os.FileInfo returns a *syscall.Stat_t.
+//
+// Returns the error of fn or of the listing, if any
+func (fd *Fd) ReaddirFunc(fn func(os.FileInfo) error) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+
+	return fd.readdirplus(0, func(name string, stat *syscall.Stat_t) error {
+		err := fn(fileInfoFromStat(stat, name))
+		if errors.Is(err, SkipEntry) {
+			return nil
+		}
+		return err
+	})
+}
+
+// StatAt returns the Stat of the entry name relative to the directory
+// referred to by the Fd, without resolving the full path again.
+//
+// No released libgfapi (up to and including 11) provides glfs_fstatat, so
+// StatAt currently always returns ErrNotSupported.
+func (fd *Fd) StatAt(name string) (*Stat, error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+	return nil, ErrNotSupported
+}
+
+// OpenAt opens the entry name relative to the directory referred to by the
+// Fd with the given flags, without resolving the full path again.
+//
+// No released libgfapi (up to and including 11) provides glfs_openat, so
+// OpenAt currently always returns ErrNotSupported.
+func (fd *Fd) OpenAt(name string, flags int) (*Fd, error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+	return nil, ErrNotSupported
+}
+
+// DirEntry is an entry read from a directory along with its type and, when
+// read with readdirplus, its Stat. It implements fs.DirEntry.
+type DirEntry struct {
+	name string
+	typ  FileType
+	stat *Stat
+	// info builds the fs.FileInfo of Info on first use, nil when the entry
+	// was read without its stat
+	info func() fs.FileInfo
+}
+
+var _ fs.DirEntry = (*DirEntry)(nil)
+
+// newDirEntry returns the DirEntry of name read by readdirplus. The type
+// comes from the d_type typ of the dirent, and from the stat st, which is
+// copied, when the dirent doesn't report it.
+func newDirEntry(name string, typ uint8, st *syscall.Stat_t) DirEntry {
+	sys := *st
+	de := DirEntry{
+		name: name,
+		typ:  fileTypeFromDirent(typ),
+		stat: statFromSyscall(&sys),
+		info: sync.OnceValue(func() fs.FileInfo {
+			return fileInfoFromStat(&sys, name)
+		}),
+	}
+	if de.typ == TypeUnknown {
+		de.typ = fileTypeFromMode(uint32(sys.Mode))
+	}
+	return de
+}
+
+// Name returns the name of the entry
+func (de *DirEntry) Name() string {
+	return de.name
+}
+
+// FileType returns the type of the entry
+func (de *DirEntry) FileType() FileType {
+	return de.typ
+}
+
+// IsDir reports whether the entry is a directory
+func (de *DirEntry) IsDir() bool {
+	return de.typ == TypeDir
+}
+
+// Type returns the type bits of the entry as an fs.FileMode, 0 for a regular
+// file and for an entry of unknown type
+func (de *DirEntry) Type() fs.FileMode {
+	return de.typ.fsMode()
+}
+
+// Info returns the fs.FileInfo of the entry, built from the stat captured
+// while reading the directory, so it makes no stat call.
+//
+// Returns an error wrapping ErrNotSupported for the entries read without their
+// stat by ReaddirMode, which can't be stated relative to the directory (see
+// StatAt)
+func (de *DirEntry) Info() (fs.FileInfo, error) {
+	if de.info == nil {
+		return nil, &fs.PathError{Op: "stat", Path: de.name, Err: ErrNotSupported}
+	}
+	return de.info(), nil
+}
+
+// Stat returns the Stat of the entry, captured while reading the directory.
+// It is nil for the entries read without their Stat by ReaddirMode.
+func (de *DirEntry) Stat() *Stat {
+	return de.stat
+}
+
+// ReaddirStat returns the entries of a directory along with their Stat,
+// without needing an extra stat call per entry.
+//
+// The Stats carry no creation time: glfs_readdirplus only fills a struct stat,
+// and no released libgfapi (up to and including 11) has a readdirplus
+// returning a glfs_stat, which would carry the btime. The btime bit of the
+// mask of the Stats is cleared accordingly.
+//
+// n is the maximum number of items to return and works the same way as Readdir.
+func (fd *Fd) ReaddirStat(n int) ([]DirEntry, error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+
+	var entries []DirEntry
+
+	err := fd.readdirplusDirent(n, func(name string, typ uint8, stat *syscall.Stat_t) error {
+		entries = append(entries, newDirEntry(name, typ, stat))
+		return nil
+	})
+	if err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// readdirplus reads at most n entries from the directory using
+// glfs_readdirplus, and calls fn for each entry. The name passed to fn is a
+// copy, but the stat is reused between the calls and the dirent it comes from
+// belongs to the fd, so fn must copy the stat to keep it. The reading stops at
+// the first error returned by fn, which is returned.
+func (fd *Fd) readdirplus(n int, fn func(name string, stat *syscall.Stat_t) error) error {
+	return fd.readdirplusDirent(n, func(name string, _ uint8, stat *syscall.Stat_t) error {
+		return fn(name, stat)
+	})
+}
+
+// readdirplusDirent is readdirplus passing fn the d_type of the dirent too
+func (fd *Fd) readdirplusDirent(n int, fn func(name string, typ uint8, stat *syscall.Stat_t) error) error {
+	if !fd.isDir {
+		return ErrNotDirectory
+	}
+
 	var (
 		stat  syscall.Stat_t
-		files []os.FileInfo
 		statP = (*C.struct_stat)(unsafe.Pointer(&stat))
 	)
 
 	for i := 0; n == 0 || i < n; i++ {
 		d, err := C.glfs_readdirplus(fd.fd, statP)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		dirent := (*syscall.Dirent)(unsafe.Pointer(d))
@@ -303,24 +2020,103 @@ func (fd *Fd) Readdir(n int) ([]os.FileInfo, error) {
 			break
 		}
 
-		name := direntName(dirent)
-		file := fileInfoFromStat(&stat, name)
-		files = append(files, file)
+		if err := fn(direntName(dirent), dirent.Type, &stat); err != nil {
+			return err
+		}
 	}
 
-	return files, nil
+	return nil
+}
+
+// errStopReaddir stops readdirplus once enough entries have been read
+var errStopReaddir = errors.New("stop reading the directory")
+
+// ReaddirFS returns the entries of a directory as fs.DirEntry values, to be
+// used with the io/fs directory walking APIs. The entries are DirEntry values
+// read with glfs_readdirplus: their type comes from the d_type of the dirent,
+// and their Info is built on first use from the stat read along with them, so
+// no further stat call is made. The "." and ".." entries are skipped.
+//
+// n is the maximum number of items to return and works the same way as
+// Readdir. The skipped "." and ".." entries don't count against n: when n > 0
+// the reading goes on until n entries or the end of the directory, so an empty
+// result means the end of the directory.
+//
+// Returns the entries read so far along with the error on failure
+func (fd *Fd) ReaddirFS(n int) ([]fs.DirEntry, error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+
+	var entries []fs.DirEntry
+
+	err := fd.readdirplusDirent(0, func(name string, typ uint8, stat *syscall.Stat_t) error {
+		if name == "." || name == ".." {
+			return nil
+		}
+		de := newDirEntry(name, typ, stat)
+		entries = append(entries, &de)
+		if n > 0 && len(entries) == n {
+			return errStopReaddir
+		}
+		return nil
+	})
+	if err != nil && err != errStopReaddir {
+		return entries, err
+	}
+	return entries, nil
 }
 
 // Readdirnames returns the names of files in a directory.
 //
 // n is the maximum number of items to return and works the same way as Readdir.
 func (fd *Fd) Readdirnames(n int) ([]string, error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+	if !fd.isDir {
+		return nil, ErrNotDirectory
+	}
+
 	var names []string
 
 	for i := 0; n == 0 || i < n; i++ {
 		d, err := C.glfs_readdir(fd.fd)
 		if err != nil {
-			return nil, err
+			return names, err
+		}
+
+		dirent := (*syscall.Dirent)(unsafe.Pointer(d))
+		if dirent == nil {
+			break
+		}
+
+		name := direntName(dirent)
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// ReaddirFiltered returns the names of files in a directory which start with
+// prefix. The "." and ".." entries are skipped. If sorted is true the names
+// are sorted.
+//
+// n is the maximum number of items to return and works the same way as Readdirnames.
+func (fd *Fd) ReaddirFiltered(n int, prefix string, sorted bool) ([]string, error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+	if !fd.isDir {
+		return nil, ErrNotDirectory
+	}
+
+	var names []string
+
+	for n == 0 || len(names) < n {
+		d, err := C.glfs_readdir(fd.fd)
+		if err != nil {
+			return names, err
 		}
 
 		dirent := (*syscall.Dirent)(unsafe.Pointer(d))
@@ -329,8 +2125,154 @@ func (fd *Fd) Readdirnames(n int) ([]string, error) {
 		}
 
 		name := direntName(dirent)
+		if name == "." || name == ".." || !strings.HasPrefix(name, prefix) {
+			continue
+		}
 		names = append(names, name)
 	}
 
+	if sorted {
+		sort.Strings(names)
+	}
+
 	return names, nil
 }
+
+// FileType is the type of a directory entry, as reported by the d_type field
+// of its dirent
+type FileType uint8
+
+// fsMode returns the type bits of the fs.FileMode of the FileType, 0 for
+// TypeRegular and TypeUnknown
+func (t FileType) fsMode() fs.FileMode {
+	switch t {
+	case TypeDir:
+		return fs.ModeDir
+	case TypeSymlink:
+		return fs.ModeSymlink
+	case TypeBlockDevice:
+		return fs.ModeDevice
+	case TypeCharDevice:
+		return fs.ModeDevice | fs.ModeCharDevice
+	case TypeNamedPipe:
+		return fs.ModeNamedPipe
+	case TypeSocket:
+		return fs.ModeSocket
+	}
+	return 0
+}
+
+// TypeUnknown .. TypeSocket are the FileType values. TypeUnknown is used when
+// the type isn't reported (DT_UNKNOWN), in which case a stat is needed.
+const (
+	TypeUnknown FileType = iota
+	TypeRegular
+	TypeDir
+	TypeSymlink
+	TypeBlockDevice
+	TypeCharDevice
+	TypeNamedPipe
+	TypeSocket
+)
+
+// DirEntryType is the name of a directory entry along with its type
+type DirEntryType struct {
+	Name string
+	Type FileType
+}
+
+// fileTypeFromDirent returns the FileType of the given d_type value
+func fileTypeFromDirent(typ uint8) FileType {
+	switch typ {
+	case syscall.DT_REG:
+		return TypeRegular
+	case syscall.DT_DIR:
+		return TypeDir
+	case syscall.DT_LNK:
+		return TypeSymlink
+	case syscall.DT_BLK:
+		return TypeBlockDevice
+	case syscall.DT_CHR:
+		return TypeCharDevice
+	case syscall.DT_FIFO:
+		return TypeNamedPipe
+	case syscall.DT_SOCK:
+		return TypeSocket
+	}
+	return TypeUnknown
+}
+
+// fileTypeFromMode returns the FileType of the given raw posix mode
+func fileTypeFromMode(mode uint32) FileType {
+	switch mode & syscall.S_IFMT {
+	case syscall.S_IFREG:
+		return TypeRegular
+	case syscall.S_IFDIR:
+		return TypeDir
+	case syscall.S_IFLNK:
+		return TypeSymlink
+	case syscall.S_IFBLK:
+		return TypeBlockDevice
+	case syscall.S_IFCHR:
+		return TypeCharDevice
+	case syscall.S_IFIFO:
+		return TypeNamedPipe
+	case syscall.S_IFSOCK:
+		return TypeSocket
+	}
+	return TypeUnknown
+}
+
+// ReaddirMode returns the entries of a directory, reading them with
+// glfs_readdirplus when withStat is true, so the entries carry their Stat,
+// and with the cheaper glfs_readdir otherwise, so the entries only carry
+// their name and the type of their dirent.
+//
+// n is the maximum number of items to return and works the same way as Readdir.
+func (fd *Fd) ReaddirMode(n int, withStat bool) ([]DirEntry, error) {
+	if withStat {
+		return fd.ReaddirStat(n)
+	}
+
+	types, err := fd.ReaddirTypes(n)
+	entries := make([]DirEntry, len(types))
+	for i, t := range types {
+		entries[i] = DirEntry{name: t.Name, typ: t.Type}
+	}
+	return entries, err
+}
+
+// ReaddirTypes returns the names of files in a directory along with their
+// type. The type comes from the dirent, so it is much cheaper than Readdir
+// which needs a stat of every entry.
+//
+// n is the maximum number of items to return and works the same way as Readdirnames.
+func (fd *Fd) ReaddirTypes(n int) ([]DirEntryType, error) {
+	if fd.fd == nil {
+		return nil, ErrClosed
+	}
+	if !fd.isDir {
+		return nil, ErrNotDirectory
+	}
+
+	var entries []DirEntryType
+
+	for i := 0; n == 0 || i < n; i++ {
+		d, err := C.glfs_readdir(fd.fd)
+		if err != nil {
+			return entries, err
+		}
+
+		dirent := (*syscall.Dirent)(unsafe.Pointer(d))
+		if dirent == nil {
+			break
+		}
+
+		entries = append(entries, DirEntryType{
+			Name: direntName(dirent),
+			Type: fileTypeFromDirent(dirent.Type),
+		})
+	}
+
+	return entries, nil
+}
@@ -8,8 +8,10 @@ package gfapi
 // #include <sys/stat.h>
 import "C"
 import (
+	"context"
 	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"syscall"
 )
@@ -18,22 +20,51 @@ import (
 type File struct {
 	name string
 	Fd
-	isDir bool
 }
 
+// File implements fs.File, and fs.ReadDirFile for directories, so it can be
+// used with io/fs consumers
+var _ fs.ReadDirFile = (*File)(nil)
+
 // Close closes an open File.
 // Close is similar to os.Close in its functioning.
 //
-// Returns an Error on failure.
+// Close does not imply that written data reached the storage, use CloseSync
+// or Sync before Close for durability.
+//
+// Close is idempotent: only the first call closes the fd, the following calls
+// return ErrClosed without reaching libgfapi, so a deferred Close can safely
+// follow an explicit one whose error is checked.
+//
+// The calls abandoned on a deadline or by SyncTimeout still use the fd in the
+// background, Close waits for them to complete before closing it.
+//
+// Returns an Error on failure, and ErrClosed if the File was already closed.
 func (f *File) Close() error {
 	var err error
 	var ret C.int
 
-	if f.isDir {
+	if f == nil {
+		return os.ErrInvalid
+	}
+
+	// Serialize with the operations holding the Fd lock, such as Append,
+	// and with concurrent calls to Close
+	f.Fd.mu.Lock()
+	defer f.Fd.mu.Unlock()
+	f.Fd.inflight.Lock()
+	defer f.Fd.inflight.Unlock()
+
+	if f.Fd.fd == nil {
+		return ErrClosed
+	}
+
+	if f.Fd.isDir {
 		ret, err = C.glfs_closedir(f.Fd.fd)
 	} else {
 		ret, err = C.glfs_close(f.Fd.fd)
 	}
+	f.Fd.fd = nil
 	if ret < 0 {
 		return err
 	}
@@ -41,6 +72,18 @@ func (f *File) Close() error {
 	return nil
 }
 
+// CloseSync commits the file to the storage and then closes it. Close is
+// attempted even if the sync fails.
+//
+// Returns the first error encountered
+func (f *File) CloseSync() error {
+	_, _, err := f.Fd.SyncStat()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
 // Chdir has not been implemented yet
 func (f *File) Chdir() error {
 	return errors.New("Chdir has not been implemented yet")
@@ -96,6 +139,28 @@ func (f *File) Readdir(n int) ([]os.FileInfo, error) {
 	return f.Fd.Readdir(n)
 }
 
+// ReaddirContext returns the information of files in a directory, stopping
+// with ctx.Err() when ctx is done.
+//
+// n is the maximum number of items to return and works the same way as Readdir.
+func (f *File) ReaddirContext(ctx context.Context, n int) ([]os.FileInfo, error) {
+	return f.Fd.ReaddirContext(ctx, n)
+}
+
+// ReaddirStat returns the entries of a directory along with their Stat.
+//
+// n is the maximum number of items to return and works the same way as Readdir.
+func (f *File) ReaddirStat(n int) ([]DirEntry, error) {
+	return f.Fd.ReaddirStat(n)
+}
+
+// ReaddirTypes returns the names of files in a directory along with their type.
+//
+// n is the maximum number of items to return and works the same way as Readdir.
+func (f *File) ReaddirTypes(n int) ([]DirEntryType, error) {
+	return f.Fd.ReaddirTypes(n)
+}
+
 // Readdirnames returns the names of files in a directory.
 //
 // n is the maximum number of items to return and works the same way as Readdir.
@@ -103,15 +168,48 @@ func (f *File) Readdirnames(n int) ([]string, error) {
 	return f.Fd.Readdirnames(n)
 }
 
+// ReadDir reads the contents of the directory and returns a slice of at
+// most n fs.DirEntry values. ReadDir is similar to os.File.ReadDir in its
+// functioning, and implements fs.ReadDirFile. The "." and ".." entries are
+// skipped and don't count against n.
+//
+// If n > 0 and there are no more entries io.EOF is returned. If n <= 0 all
+// the remaining entries are returned. On error the entries read so far are
+// returned along with the error.
+func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n < 0 {
+		n = 0
+	}
+
+	entries, err := f.Fd.ReaddirFS(n)
+	if err != nil {
+		return entries, &os.PathError{Op: "readdir", Path: f.name, Err: err}
+	}
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
+}
+
+// ReaddirFiltered returns the names of files in a directory which start with
+// prefix, skipping "." and "..". If sorted is true the names are sorted.
+//
+// n is the maximum number of items to return and works the same way as Readdirnames.
+func (f *File) ReaddirFiltered(n int, prefix string, sorted bool) ([]string, error) {
+	return f.Fd.ReaddirFiltered(n, prefix, sorted)
+}
+
 // Seek sets the offset for the next read or write on the file based on whence,
-// 0 - relative to beginning of file, 1 - relative to current offset, 2 - relative to end
+// SeekStart - relative to beginning of file, SeekCurrent - relative to current offset,
+// SeekEnd - relative to end
 //
 // Returns new offset and an error if any
 func (f *File) Seek(offset int64, whence int) (int64, error) {
-	return f.Fd.lseek(offset, whence)
+	return f.Fd.Seek(offset, whence)
 }
 
-// Stat returns an os.FileInfo object describing the file
+// Stat returns an os.FileInfo object describing the file.
+// The Sys method of the returned os.FileInfo returns a *syscall.Stat_t.
 //
 // Returns an error on failure
 func (f *File) Stat() (os.FileInfo, error) {
@@ -138,7 +236,8 @@ func (f *File) Truncate(size int64, prestat, poststat *Stat) error {
 	return f.Fd.Ftruncate(size, prestat.ToGlfsStat(), poststat.ToGlfsStat())
 }
 
-// Write writes len(b) bytes to the file
+// Write writes len(b) bytes to the file. It keeps writing until all of b
+// has been written or an error occurs.
 //
 // Returns number of bytes written and an error if any
 func (f *File) Write(b []byte) (n int, err error) {
@@ -156,18 +255,22 @@ func (f *File) Write(b []byte) (n int, err error) {
 	return n, err
 }
 
-// WriteAt writes len(b) bytes to the file starting at offset off
+// WriteAt writes len(b) bytes to the file starting at offset off. Writing
+// past the end of the file extends it, the gap between the old end and off is
+// a hole which reads as zeros but isn't allocated. off is ignored when the
+// file was opened with O_APPEND, see Fd.Pwrite.
 //
 // Returns number of bytes written and an error if any
 func (f *File) WriteAt(b []byte, off int64, prestat, poststat *Stat) (int, error) {
 	return f.Fd.Pwrite(b, off, prestat.ToGlfsStat(), poststat.ToGlfsStat())
 }
 
-// WriteString writes the contents of string s to the file
+// WriteString writes the contents of string s to the file, with the same
+// full-write guarantee as Write
 //
 // Returns number of bytes written and an error if any
 func (f *File) WriteString(s string) (int, error) {
-	return f.Write([]byte(s))
+	return f.Write(stringBytes(s))
 }
 
 // Manipulate the allocated disk space for the file
@@ -197,3 +300,65 @@ func (f *File) Setxattr(attr string, data []byte, flags int) error {
 func (f *File) Removexattr(attr string) error {
 	return f.Fd.Fremovexattr(attr)
 }
+
+// GlusterFile wraps a File with the method set of *os.File commonly used by
+// programs written against local files, so they can be moved to gluster by
+// accepting an interface satisfied by both. Unlike the methods of File, those
+// of GlusterFile take no extra Stat arguments, and Read returns io.EOF at the
+// end of the file. The other methods of the Fd are promoted as they are.
+type GlusterFile struct {
+	*Fd
+	f *File
+}
+
+// NewGlusterFile returns a GlusterFile wrapping f
+func NewGlusterFile(f *File) *GlusterFile {
+	return &GlusterFile{Fd: &f.Fd, f: f}
+}
+
+// Name returns the name of the opened file
+func (g *GlusterFile) Name() string {
+	return g.f.Name()
+}
+
+// Read reads at most len(b) bytes into b, like os.File.Read
+//
+// Returns number of bytes read and an error if any, io.EOF at the end of the file
+func (g *GlusterFile) Read(b []byte) (int, error) {
+	return g.f.Read(b)
+}
+
+// Write writes len(b) bytes into the file, like os.File.Write
+//
+// Returns number of bytes written and an error if any
+func (g *GlusterFile) Write(b []byte) (int, error) {
+	return g.f.Write(b)
+}
+
+// Stat returns an os.FileInfo describing the file, like os.File.Stat
+//
+// Returns an error on failure
+func (g *GlusterFile) Stat() (os.FileInfo, error) {
+	return g.f.Stat()
+}
+
+// Truncate changes the size of the file, like os.File.Truncate
+//
+// Returns error on failure
+func (g *GlusterFile) Truncate(size int64) error {
+	return g.Fd.Ftruncate(size, nil, nil)
+}
+
+// Sync commits the file to the storage, like os.File.Sync
+//
+// Returns error on failure
+func (g *GlusterFile) Sync() error {
+	return g.Fd.Fsync(nil, nil)
+}
+
+// Close closes the file, like File.Close
+//
+// Returns error on failure, and ErrClosed if the file was already closed
+func (g *GlusterFile) Close() error {
+	return g.f.Close()
+}
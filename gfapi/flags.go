@@ -0,0 +1,86 @@
+package gfapi
+
+// This file includes the open flags of the files and fds
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Open flags of Volume.OpenFile, with the values expected by libgfapi on the
+// target platform. Besides being passed to libgfapi, the access mode and
+// O_APPEND are honored by the Fd itself: an Fd opened with O_RDONLY refuses
+// writes with ErrReadOnly, and Append and AppendFrame rely on O_APPEND when
+// it is set. O_DIRECT is 0 where the platform has no direct I/O.
+const (
+	O_RDONLY = os.O_RDONLY
+	O_WRONLY = os.O_WRONLY
+	O_RDWR   = os.O_RDWR
+	O_APPEND = os.O_APPEND
+	O_CREATE = os.O_CREATE
+	O_EXCL   = os.O_EXCL
+	O_TRUNC  = os.O_TRUNC
+	O_SYNC   = os.O_SYNC
+	O_DSYNC  = syscall.O_DSYNC
+	O_DIRECT = oDirect
+)
+
+// ParseFlags returns the open flags described by spec, a string of the
+// following letters in any order:
+//
+//	r	open for reading
+//	w	open for writing
+//	a	append, implies w
+//	c	create the file if it doesn't exist
+//	x	with c, fail if the file exists
+//	t	truncate the file
+//	s	synchronous writes (O_SYNC)
+//	d	direct I/O (O_DIRECT)
+//
+// e.g. "rw" is O_RDWR and "wac" is O_WRONLY|O_APPEND|O_CREATE.
+//
+// Returns error if spec holds an unknown letter or neither r, w nor a
+func ParseFlags(spec string) (int, error) {
+	var read, write bool
+	var flags int
+
+	for _, c := range spec {
+		switch c {
+		case 'r':
+			read = true
+		case 'w':
+			write = true
+		case 'a':
+			write = true
+			flags |= O_APPEND
+		case 'c':
+			flags |= O_CREATE
+		case 'x':
+			flags |= O_EXCL
+		case 't':
+			flags |= O_TRUNC
+		case 's':
+			flags |= O_SYNC
+		case 'd':
+			if O_DIRECT == 0 {
+				return 0, fmt.Errorf("open flags %q: direct I/O isn't available", spec)
+			}
+			flags |= O_DIRECT
+		default:
+			return 0, fmt.Errorf("open flags %q: unknown flag %q", spec, c)
+		}
+	}
+
+	switch {
+	case read && write:
+		flags |= O_RDWR
+	case write:
+		flags |= O_WRONLY
+	case read:
+		flags |= O_RDONLY
+	default:
+		return 0, fmt.Errorf("open flags %q: no access mode", spec)
+	}
+	return flags, nil
+}
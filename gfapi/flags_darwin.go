@@ -0,0 +1,4 @@
+package gfapi
+
+// oDirect is the O_DIRECT open flag, 0 where it isn't available
+const oDirect = 0
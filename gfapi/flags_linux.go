@@ -0,0 +1,8 @@
+package gfapi
+
+import (
+	"syscall"
+)
+
+// oDirect is the O_DIRECT open flag, 0 where it isn't available
+const oDirect = syscall.O_DIRECT
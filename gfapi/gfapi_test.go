@@ -1,12 +1,26 @@
 package gfapi
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 /* The testcases assume that it is being run on a peer in a gluster cluster,
@@ -370,6 +384,2817 @@ func TestReaddirnames(t *testing.T) {
 		"file names doesn't match %v != %v", all, expected)
 }
 
+func TestReaddirStat(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+
+	entries, err := d.ReaddirStat(0)
+	check(t, err == nil, "ReaddirStat %q: %s", tmpDir, err)
+
+	err = d.Close()
+	check(t, err == nil, "Close %q: %s", tmpDir, err)
+
+	check(t, len(entries) == 4,
+		"incorrect number of files %v != %v", len(entries), 4)
+
+	for _, e := range entries {
+		if e.Name() != "file" {
+			continue
+		}
+		check(t, e.Stat() != nil, "no stat for file")
+		check(t, e.Stat().Size() == int64(len(data)),
+			"incorrect file size %v != %v", e.Stat().Size(), len(data))
+		return
+	}
+	t.Fatalf("no entry for file")
+}
+
+func TestReaddirTypes(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+
+	entries, err := d.ReaddirTypes(0)
+	check(t, err == nil, "ReaddirTypes %q: %s", tmpDir, err)
+
+	err = d.Close()
+	check(t, err == nil, "Close %q: %s", tmpDir, err)
+
+	check(t, len(entries) == 4,
+		"incorrect number of files %v != %v", len(entries), 4)
+
+	types := map[string]FileType{}
+	for _, e := range entries {
+		types[e.Name] = e.Type
+	}
+	check(t, types["file"] == TypeRegular, "file should be regular, %v", types["file"])
+	check(t, types["dir"] == TypeDir, "dir should be a directory, %v", types["dir"])
+}
+
+func TestReadDir(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer d.Close()
+
+	var f fs.File = d
+	rd, ok := f.(fs.ReadDirFile)
+	check(t, ok, "File should implement fs.ReadDirFile")
+
+	// "." and ".." come first but don't count against n
+	entries, err := rd.ReadDir(1)
+	check(t, err == nil && len(entries) == 1, "the first ReadDir(1) %q should return one entry: %v, %v", tmpDir, len(entries), err)
+
+	names := []string{entries[0].Name()}
+	for {
+		entries, err := rd.ReadDir(1)
+		if err == io.EOF {
+			break
+		}
+		check(t, err == nil, "ReadDir %q: %s", tmpDir, err)
+		for _, e := range entries {
+			names = append(names, e.Name())
+			if e.Name() == "dir" {
+				check(t, e.IsDir(), "dir should be a directory")
+			}
+		}
+	}
+
+	sort.Strings(names)
+	check(t, reflect.DeepEqual(names, []string{"dir", "file"}),
+		"file names doesn't match %v", names)
+
+	fi, err := f.Stat()
+	check(t, err == nil, "Stat %q: %s", tmpDir, err)
+	check(t, fi.IsDir(), "%q should be a directory", tmpDir)
+}
+
+func TestStatAt(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer d.Close()
+
+	_, err = d.StatAt("file")
+	check(t, err == ErrNotSupported, "StatAt should not be supported, %v", err)
+
+	_, err = d.OpenAt("file", os.O_RDONLY)
+	check(t, err == ErrNotSupported, "OpenAt should not be supported, %v", err)
+}
+
+func TestReaddirFiltered(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+
+	names, err := d.ReaddirFiltered(0, "", true)
+	check(t, err == nil, "ReaddirFiltered %q: %s", tmpDir, err)
+
+	err = d.Close()
+	check(t, err == nil, "Close %q: %s", tmpDir, err)
+
+	expected := []string{"dir", "file"}
+	check(t, reflect.DeepEqual(names, expected),
+		"file names doesn't match %v != %v", names, expected)
+
+	// test filtering by prefix with limit
+
+	d, err = vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+
+	names, err = d.ReaddirFiltered(1, "fi", false)
+	check(t, err == nil, "ReaddirFiltered %q: %s", tmpDir, err)
+	check(t, len(names) == 1 && names[0] == "file",
+		"incorrect filtered names %v", names)
+
+	names, err = d.ReaddirFiltered(1, "fi", false)
+	check(t, err == nil, "ReaddirFiltered %q: %s", tmpDir, err)
+	check(t, len(names) == 0, "should not read more files")
+
+	err = d.Close()
+	check(t, err == nil, "Close %q: %s", tmpDir, err)
+}
+
+func TestStatSys(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	file := filepath.Join(tmpDir, "file")
+	fi, err := vol.Stat(file)
+	check(t, err == nil, "Stat %q: %s", file, err)
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	check(t, ok, "Sys() returned %T, not *syscall.Stat_t", fi.Sys())
+	check(t, st.Size == int64(len(data)),
+		"incorrect size from Sys() %v != %v", st.Size, len(data))
+	check(t, st.Nlink == 1, "incorrect nlink from Sys() %v != 1", st.Nlink)
+}
+
+func TestOffset(t *testing.T) {
+	path := "/TestOffset"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	off, err := f.Offset()
+	check(t, err == nil, "Offset %q: %s", path, err)
+	check(t, off == int64(len(data)), "incorrect offset %v != %v", off, len(data))
+
+	// Offset must not move the file offset
+	off, err = f.Offset()
+	check(t, err == nil, "Offset %q: %s", path, err)
+	check(t, off == int64(len(data)), "offset moved %v != %v", off, len(data))
+}
+
+func TestFdSeek(t *testing.T) {
+	path := "/TestFdSeek"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	var seeker io.Seeker = &f.Fd
+	off, err := seeker.Seek(-1, SeekEnd)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	check(t, off == int64(len(data)-1), "incorrect offset %v != %v", off, len(data)-1)
+
+	off, err = seeker.Seek(-1, SeekCurrent)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	check(t, off == int64(len(data)-2), "incorrect offset %v != %v", off, len(data)-2)
+
+	off, err = seeker.Seek(1, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	check(t, off == 1, "incorrect offset %v != 1", off)
+}
+
+func TestSeekDataHole(t *testing.T) {
+	path := "/TestSeekDataHole"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	off, err := f.SeekData(0)
+	if err == ErrSeekNotSupported {
+		t.Skip("SEEK_DATA not supported by volume")
+	}
+	check(t, err == nil, "SeekData %q: %s", path, err)
+	check(t, off == 0, "incorrect data offset %v != 0", off)
+
+	off, err = f.SeekHole(0)
+	check(t, err == nil, "SeekHole %q: %s", path, err)
+	check(t, off == int64(len(data)), "incorrect hole offset %v != %v", off, len(data))
+}
+
+func TestFdWriteString(t *testing.T) {
+	path := "/TestFdWriteString"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	n, err := f.Fd.WriteString(string(data))
+	check(t, err == nil, "WriteString %q: %s", path, err)
+	check(t, n == len(data), "write length incorrect, %v != %v", n, len(data))
+
+	fi, err := f.Stat()
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Size() == int64(len(data)),
+		"incorrect file size %v != %v", fi.Size(), len(data))
+}
+
+func TestPositionalEmptyBuffer(t *testing.T) {
+	path := "/TestPositionalEmptyBuffer"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	n, err := f.Pwrite([]byte{}, 0, nil, nil)
+	check(t, err == nil && n == 0, "Pwrite empty buffer: %v, %s", n, err)
+
+	n, err = f.Pread(nil, 0, nil)
+	check(t, err == nil && n == 0, "Pread empty buffer: %v, %s", n, err)
+
+	n, err = f.WriteAt([]byte{}, 0, nil, nil)
+	check(t, err == nil && n == 0, "WriteAt empty buffer: %v, %s", n, err)
+
+	n, err = f.ReadAt(nil, 0, nil)
+	check(t, err == nil && n == 0, "ReadAt empty buffer: %v, %s", n, err)
+
+	for _, bufs := range []net.Buffers{nil, {nil, {}}} {
+		m, err := f.WriteBuffers(&bufs)
+		check(t, err == nil && m == 0, "WriteBuffers empty buffers: %v, %s", m, err)
+
+		m, err = f.ReadBuffers(&bufs)
+		check(t, err == nil && m == 0, "ReadBuffers empty buffers: %v, %s", m, err)
+	}
+}
+
+func TestMetricsObserver(t *testing.T) {
+	path := "/TestMetricsObserver"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	var ops []string
+	var written int
+	SetMetricsObserver(func(op string, bytes int, dur time.Duration, err error) {
+		ops = append(ops, op)
+		if op == "write" {
+			written += bytes
+		}
+	})
+	defer SetMetricsObserver(nil)
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	SetMetricsObserver(nil)
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	check(t, reflect.DeepEqual(ops, []string{"write"}), "incorrect observed ops %v", ops)
+	check(t, written == len(data), "incorrect observed bytes %v != %v", written, len(data))
+}
+
+func TestIOQueue(t *testing.T) {
+	path := "/TestIOQueue"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	q, err := NewIOQueue(&f.Fd, 2)
+	check(t, err == nil, "NewIOQueue: %s", err)
+
+	const count = 8
+	go func() {
+		for i := 0; i < count; i++ {
+			if err := q.SubmitWrite(data, int64(i*len(data))); err != nil {
+				t.Errorf("SubmitWrite: %s", err)
+			}
+		}
+		q.Close()
+	}()
+
+	var written int
+	for r := range q.Completions() {
+		check(t, r.Err == nil, "async write at %v: %s", r.Off, r.Err)
+		written += r.N
+	}
+	check(t, written == count*len(data), "incorrect bytes written %v != %v", written, count*len(data))
+
+	fi, err := f.Stat()
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Size() == int64(count*len(data)),
+		"incorrect file size %v != %v", fi.Size(), count*len(data))
+
+	_, err = NewIOQueue(&f.Fd, 0)
+	check(t, err == ErrIOQueueDepth, "NewIOQueue with zero depth should fail, %v", err)
+}
+
+func TestSyncStat(t *testing.T) {
+	path := "/TestSyncStat"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	pre, post, err := f.SyncStat()
+	check(t, err == nil, "SyncStat %q: %s", path, err)
+	check(t, pre != nil && post != nil, "SyncStat %q returned nil stats", path)
+	check(t, post.Size() == int64(len(data)),
+		"incorrect post-sync size %v != %v", post.Size(), len(data))
+	check(t, post.Blocks() > 0, "no blocks allocated after sync")
+	check(t, post.PreferredIOSize() > 0, "incorrect preferred I/O size %v", post.PreferredIOSize())
+}
+
+func TestClosedFd(t *testing.T) {
+	path := "/TestClosedFd"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+
+	err = f.Close()
+	check(t, err == nil, "Close %q: %s", path, err)
+
+	err = f.Close()
+	check(t, errors.Is(err, os.ErrClosed), "second Close should fail with ErrClosed, %v", err)
+
+	buf := make([]byte, 1)
+	var stat syscall.Stat_t
+	errs := map[string]error{}
+	errs["Fchmod"] = f.Fd.Fchmod(0644)
+	errs["Fstat"] = f.Fd.Fstat(&stat)
+	_, _, errs["SyncStat"] = f.Fd.SyncStat()
+	errs["Ftruncate"] = f.Fd.Ftruncate(0, nil, nil)
+	_, errs["Pread"] = f.Fd.Pread(buf, 0, nil)
+	_, errs["Pwrite"] = f.Fd.Pwrite(buf, 0, nil, nil)
+	_, errs["Read"] = f.Fd.Read(buf)
+	_, errs["Write"] = f.Fd.Write(buf)
+	_, errs["WriteString"] = f.Fd.WriteString("a")
+	_, errs["Offset"] = f.Fd.Offset()
+	_, errs["SeekData"] = f.Fd.SeekData(0)
+	_, errs["SeekHole"] = f.Fd.SeekHole(0)
+	errs["Fallocate"] = f.Fd.Fallocate(0, 0, 1)
+	_, errs["Fgetxattr"] = f.Fd.Fgetxattr("user.test", buf)
+	errs["Fsetxattr"] = f.Fd.Fsetxattr("user.test", buf, 0)
+	errs["Fremovexattr"] = f.Fd.Fremovexattr("user.test")
+	_, errs["Readdir"] = f.Fd.Readdir(0)
+	_, errs["Readdirnames"] = f.Fd.Readdirnames(0)
+	_, errs["ReaddirFiltered"] = f.Fd.ReaddirFiltered(0, "", false)
+	_, errs["Seek"] = f.Seek(0, SeekStart)
+
+	for name, err := range errs {
+		check(t, errors.Is(err, os.ErrClosed), "%s on closed fd should fail with ErrClosed, %v", name, err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	path := "/TestAppend"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	// Without O_APPEND, after moving the offset back to the start
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	n, err := f.Append(data)
+	check(t, err == nil, "Append %q: %s", path, err)
+	check(t, n == len(data), "append length incorrect, %v != %v", n, len(data))
+
+	err = f.Close()
+	check(t, err == nil, "Close %q: %s", path, err)
+
+	// With O_APPEND
+	f, err = vol.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	n, err = f.Append(data)
+	check(t, err == nil, "Append %q: %s", path, err)
+	check(t, n == len(data), "append length incorrect, %v != %v", n, len(data))
+
+	err = f.Close()
+	check(t, err == nil, "Close %q: %s", path, err)
+
+	fi, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Size() == int64(3*len(data)),
+		"incorrect file size %v != %v", fi.Size(), 3*len(data))
+}
+
+func TestPwriteAppend(t *testing.T) {
+	path := "/TestPwriteAppend"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	err = f.Close()
+	check(t, err == nil, "Close %q: %s", path, err)
+
+	f, err = vol.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	defer f.Close()
+
+	more := []byte("more")
+	n, err := f.Fd.Pwrite(more, 0, nil, nil)
+	check(t, err == nil && n == len(more), "Pwrite %q: %v, %s", path, n, err)
+
+	buf := make([]byte, 2*len(data))
+	n, err = f.Fd.ReadAt(buf, 0)
+	check(t, (err == nil || err == io.EOF) && n == len(data)+len(more), "ReadAt %q: %v, %s", path, n, err)
+	check(t, string(buf[:n]) == string(data)+string(more), "Pwrite on O_APPEND should write at the end, got %q", buf[:n])
+}
+
+func TestFdSize(t *testing.T) {
+	path := "/TestFdSize"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	size, err := f.Size()
+	check(t, err == nil, "Size %q: %s", path, err)
+	check(t, size == int64(len(data)), "incorrect size %v != %v", size, len(data))
+
+	err = f.Truncate(1, nil, nil)
+	check(t, err == nil, "Truncate %q: %s", path, err)
+
+	size, err = f.Size()
+	check(t, err == nil, "Size %q: %s", path, err)
+	check(t, size == 1, "incorrect size after truncate %v != 1", size)
+}
+
+func TestFdChmod(t *testing.T) {
+	path := "/TestFdChmod"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	for _, mode := range []os.FileMode{0644, 0755} {
+		var stat syscall.Stat_t
+
+		err = f.Fd.Chmod(mode)
+		check(t, err == nil, "Chmod %q %#o: %s", path, mode, err)
+
+		err = f.Fstat(&stat)
+		check(t, err == nil, "Fstat %q: %s", path, err)
+		check(t, stat.Mode&0777 == uint32(mode),
+			"incorrect mode %#o != %#o", stat.Mode&0777, mode)
+	}
+}
+
+func TestExtendAllocated(t *testing.T) {
+	path := "/TestExtendAllocated"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	const size = 1 << 16
+	err = f.ExtendAllocated(size)
+	check(t, err == nil, "ExtendAllocated %q: %s", path, err)
+
+	var stat syscall.Stat_t
+	err = f.Fstat(&stat)
+	check(t, err == nil, "Fstat %q: %s", path, err)
+	check(t, stat.Size == size, "incorrect size %v != %v", stat.Size, size)
+	check(t, stat.Blocks*512 >= size, "region not allocated, %v blocks", stat.Blocks)
+
+	err = f.ExtendAllocated(1)
+	check(t, err == nil, "ExtendAllocated %q: %s", path, err)
+
+	size1, err := f.Size()
+	check(t, err == nil, "Size %q: %s", path, err)
+	check(t, size1 == 1, "incorrect size after shrink %v != 1", size1)
+}
+
+func TestBuffers(t *testing.T) {
+	path := "/TestBuffers"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	bufs := net.Buffers{[]byte("hello "), nil, []byte("world")}
+	n, err := f.WriteBuffers(&bufs)
+	check(t, err == nil, "WriteBuffers %q: %s", path, err)
+	check(t, n == 11, "incorrect bytes written %v != 11", n)
+	check(t, len(bufs) == 0, "buffers not consumed, %v left", len(bufs))
+
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	a, b := make([]byte, 6), make([]byte, 16)
+	rbufs := net.Buffers{a, b}
+	n, err = f.ReadBuffers(&rbufs)
+	check(t, err == nil, "ReadBuffers %q: %s", path, err)
+	check(t, n == 11, "incorrect bytes read %v != 11", n)
+	check(t, string(a) == "hello " && string(b[:5]) == "world",
+		"incorrect contents %q %q", a, b[:5])
+	check(t, len(rbufs) == 1 && len(rbufs[0]) == 11,
+		"buffers not advanced correctly, %v", rbufs)
+
+	_, err = f.ReadBuffers(&rbufs)
+	check(t, err == io.EOF, "ReadBuffers at end of file should return io.EOF, %v", err)
+}
+
+func TestWriteToN(t *testing.T) {
+	path := "/TestWriteToN"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	for _, tc := range []struct {
+		n    int64
+		want string
+	}{
+		{2, string(data[:2])},
+		{int64(len(data)), string(data)},
+		{100, string(data)},
+	} {
+		_, err = f.Seek(0, SeekStart)
+		check(t, err == nil, "Seek %q: %s", path, err)
+
+		var buf bytes.Buffer
+		n, err := f.WriteToN(&buf, tc.n)
+		check(t, err == nil, "WriteToN %q: %s", path, err)
+		check(t, n == int64(len(tc.want)), "incorrect bytes written %v != %v", n, len(tc.want))
+		check(t, buf.String() == tc.want, "incorrect contents %q != %q", buf.String(), tc.want)
+	}
+}
+
+func TestCloseSync(t *testing.T) {
+	path := "/TestCloseSync"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	err = f.CloseSync()
+	check(t, err == nil, "CloseSync %q: %s", path, err)
+
+	err = f.CloseSync()
+	check(t, errors.Is(err, os.ErrClosed), "second CloseSync should fail with ErrClosed, %v", err)
+}
+
+func TestTruncateFunc(t *testing.T) {
+	path := "/TestTruncateFunc"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	var called bool
+	err = f.TruncateFunc(1, func(pre, post *Stat) {
+		called = true
+		check(t, pre.Size() == int64(len(data)), "incorrect pre size %v != %v", pre.Size(), len(data))
+		check(t, post.Size() == 1, "incorrect post size %v != 1", post.Size())
+	})
+	check(t, err == nil, "TruncateFunc %q: %s", path, err)
+	check(t, called, "TruncateFunc %q didn't call the observer", path)
+}
+
+func TestIgnoringEINTR(t *testing.T) {
+	// Signals never interrupt the libgfapi calls of a Go program, so EINTR is
+	// injected in the call instead
+	calls := 0
+	interrupted := func(times int, ret int, err error) func() (int, error) {
+		calls = 0
+		return func() (int, error) {
+			calls++
+			if calls <= times {
+				return -1, syscall.EINTR
+			}
+			return ret, err
+		}
+	}
+
+	n, err := ignoringEINTR(interrupted(3, len(data), syscall.EAGAIN))
+	check(t, err == nil && n == len(data) && calls == 4, "ignoringEINTR should retry until success: %v, %v, %v calls", n, err, calls)
+
+	n, err = ignoringEINTR(interrupted(2, -1, syscall.EIO))
+	check(t, err == syscall.EIO && n == -1 && calls == 3, "ignoringEINTR should return the other errors: %v, %v, %v calls", n, err, calls)
+
+	n, err = ignoringEINTR(interrupted(0, 0, nil))
+	check(t, err == nil && n == 0 && calls == 1, "ignoringEINTR of an uninterrupted call: %v, %v, %v calls", n, err, calls)
+}
+
+func TestSetCopyBufferSize(t *testing.T) {
+	path := "/TestSetCopyBufferSize"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	err = f.SetCopyBufferSize(MinCopyBufferSize - 1)
+	check(t, err != nil, "SetCopyBufferSize should reject sizes below the minimum")
+
+	err = f.SetCopyBufferSize(MinCopyBufferSize)
+	check(t, err == nil, "SetCopyBufferSize %q: %s", path, err)
+
+	big := bytes.Repeat(data, 3*MinCopyBufferSize)
+	_, err = f.Write(big)
+	check(t, err == nil, "Write %q: %s", path, err)
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	var buf bytes.Buffer
+	n, err := f.WriteToN(&buf, int64(len(big)))
+	check(t, err == nil, "WriteToN %q: %s", path, err)
+	check(t, n == int64(len(big)), "incorrect bytes written %v != %v", n, len(big))
+	check(t, bytes.Equal(buf.Bytes(), big), "incorrect contents")
+}
+
+func TestSpliceTo(t *testing.T) {
+	path := "/TestSpliceTo"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	dst, err := os.CreateTemp("", "TestSpliceTo")
+	check(t, err == nil, "CreateTemp: %s", err)
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	n, err := f.SpliceTo(dst, 1<<20)
+	check(t, err == nil, "SpliceTo %q: %s", path, err)
+	check(t, n == int64(len(data)), "incorrect bytes copied %v != %v", n, len(data))
+
+	contents, err := os.ReadFile(dst.Name())
+	check(t, err == nil, "ReadFile %q: %s", dst.Name(), err)
+	check(t, bytes.Equal(contents, data), "incorrect contents %q != %q", contents, data)
+}
+
+func TestStatChanged(t *testing.T) {
+	now := time.Now()
+	base := &Stat{size: 4, mtime: now, ctime: now, ino: 1}
+
+	same := *base
+	check(t, base.SameContents(&same), "identical stats should have the same contents")
+	check(t, !base.Changed(&same), "identical stats should not be changed")
+
+	chmod := *base
+	chmod.ctime = now.Add(time.Second)
+	check(t, base.SameContents(&chmod), "ctime change should keep the same contents")
+	check(t, base.Changed(&chmod), "ctime change should be changed")
+
+	write := *base
+	write.mtime = now.Add(time.Nanosecond)
+	check(t, !base.SameContents(&write), "mtime change should not have the same contents")
+	check(t, base.Changed(&write), "mtime change should be changed")
+
+	var nilStat *Stat
+	check(t, nilStat.SameContents(nil), "nil stats should have the same contents")
+	check(t, !nilStat.Changed(nil), "nil stats should not be changed")
+	check(t, !base.SameContents(nil) && base.Changed(nil), "nil and non-nil stats should differ")
+	check(t, !nilStat.SameContents(base) && nilStat.Changed(base), "nil and non-nil stats should differ")
+}
+
+func TestDropCache(t *testing.T) {
+	path := "/TestDropCache"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	err = f.Datasync()
+	check(t, err == nil, "Datasync %q: %s", path, err)
+
+	err = f.DropCache(0, 0)
+	check(t, err == nil, "DropCache %q: %s", path, err)
+
+	err = f.DropCache(-1, 0)
+	check(t, err == syscall.EINVAL, "DropCache with negative offset should fail, %v", err)
+}
+
+func TestPooledReader(t *testing.T) {
+	path := "/TestPooledReader"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	pool := &sync.Pool{New: func() interface{} {
+		buf := make([]byte, 2)
+		return &buf
+	}}
+	r := NewPooledReader(&f.Fd, pool)
+
+	var got []byte
+	for {
+		chunk, release, err := r.ReadChunk()
+		if err == io.EOF {
+			break
+		}
+		check(t, err == nil, "ReadChunk %q: %s", path, err)
+		got = append(got, chunk...)
+		release()
+		release()
+	}
+	check(t, bytes.Equal(got, data), "incorrect contents %q != %q", got, data)
+}
+
+func TestNewStat(t *testing.T) {
+	s := NewStat()
+	check(t, reflect.DeepEqual(s, &Stat{}), "NewStat without options should be zero, %+v", s)
+
+	mtime := time.Unix(1, 2)
+	s = NewStat(WithMode(0755|os.ModeSetuid), WithUid(1), WithGid(2), WithMtime(mtime), WithSize(3))
+	check(t, s.mode == 0755|syscall.S_ISUID, "incorrect mode %#o", s.mode)
+	check(t, s.uid == 1 && s.gid == 2, "incorrect owner %v:%v", s.uid, s.gid)
+	check(t, s.mtime.Equal(mtime), "incorrect mtime %v != %v", s.mtime, mtime)
+	check(t, s.size == 3, "incorrect size %v != 3", s.size)
+	check(t, s.mask == statMode|statUid|statGid|statMtime|statSize, "incorrect mask %#x", s.mask)
+	check(t, s.atime.IsZero(), "unset atime should be zero")
+}
+
+func TestFsetattr(t *testing.T) {
+	path := "/TestFsetattr"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	mtime := time.Unix(1500000000, 123456789)
+	err = f.Fsetattr(NewStat(WithMode(0600), WithMtime(mtime)), SetMode|SetMtime)
+	check(t, err == nil, "Fsetattr %q: %s", path, err)
+
+	fi, err := f.Stat()
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Mode().Perm() == 0600, "incorrect mode %#o != 0600", fi.Mode().Perm())
+	check(t, fi.ModTime().Equal(mtime), "incorrect mtime %v != %v", fi.ModTime(), mtime)
+}
+
+func TestDirectIO(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("O_DIRECT is only available on linux")
+	}
+
+	path := "/TestDirectIO"
+	f, err := vol.OpenFile(path, os.O_RDWR|os.O_CREATE|oDirect, 0644)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	check(t, f.DirectIO(), "%q should be opened for direct I/O", path)
+
+	_, err = f.Pwrite(data, 0, nil, nil)
+	check(t, err == syscall.EINVAL, "unaligned Pwrite should fail with EINVAL, %v", err)
+
+	buf := make([]byte, DirectIOAlignment)
+	_, err = f.Pread(buf, 1, nil)
+	check(t, err == syscall.EINVAL, "unaligned Pread should fail with EINVAL, %v", err)
+
+	g, err := vol.OpenFile(path, os.O_RDWR, 0)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	defer g.Close()
+	check(t, !g.DirectIO(), "%q should not be opened for direct I/O", path)
+
+	// The tail of a file whose size isn't aligned is the end of the file
+	_, err = g.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	n, err := f.Fd.ReadAt(buf, 0)
+	check(t, err == io.EOF && n == len(data), "ReadAt of the unaligned tail should fail with EOF, %v, %v", n, err)
+	check(t, bytes.Equal(buf[:n], data), "ReadAt returned wrong data %q", buf[:n])
+}
+
+func TestTeeReader(t *testing.T) {
+	src, archive := "/TestTeeReaderSrc", "/TestTeeReaderArchive"
+	f, err := vol.Create(src)
+	check(t, err == nil, "Create %q: %s", src, err)
+	defer vol.Unlink(src)
+	defer f.Close()
+
+	a, err := vol.Create(archive)
+	check(t, err == nil, "Create %q: %s", archive, err)
+	defer vol.Unlink(archive)
+	defer a.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", src, err)
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", src, err)
+
+	got, err := io.ReadAll(TeeReader(&f.Fd, &a.Fd))
+	check(t, err == nil, "ReadAll: %s", err)
+	check(t, bytes.Equal(got, data), "incorrect contents read %q != %q", got, data)
+
+	size, err := a.Size()
+	check(t, err == nil, "Size %q: %s", archive, err)
+	check(t, size == int64(len(data)), "incorrect archive size %v != %v", size, len(data))
+
+	// Write errors on the archive are returned by Read
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", src, err)
+	err = a.Close()
+	check(t, err == nil, "Close %q: %s", archive, err)
+
+	_, err = TeeReader(&f.Fd, &a.Fd).Read(make([]byte, len(data)))
+	check(t, errors.Is(err, os.ErrClosed), "Read should fail with the archive write error, %v", err)
+}
+
+// failingWriter fails every write after the first n bytes
+type failingWriter struct {
+	n   int
+	err error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, w.err
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteAtFull(t *testing.T) {
+	var got []byte
+	// shortWriteAt writes at most 3 bytes per call, and nothing past limit
+	shortWriteAt := func(limit int) func([]byte, int64) (int, error) {
+		return func(b []byte, off int64) (int, error) {
+			n := min(len(b), 3, max(limit-int(off), 0))
+			got = append(got[:off], b[:n]...)
+			return n, nil
+		}
+	}
+
+	content := []byte("0123456789")
+	n, err := writeAtFull(shortWriteAt(len(content)), content, 0)
+	check(t, err == nil && n == len(content), "writeAtFull with short writes: %v, %s", n, err)
+	check(t, bytes.Equal(got, content), "writeAtFull wrote %q", got)
+
+	got = nil
+	n, err = writeAtFull(shortWriteAt(5), content, 0)
+	check(t, err == io.ErrShortWrite && n == 5, "writeAtFull without progress should fail with ErrShortWrite: %v, %v", n, err)
+
+	injected := errors.New("injected write error")
+	n, err = writeAtFull(func(b []byte, off int64) (int, error) {
+		if off > 0 {
+			return 0, injected
+		}
+		return 2, nil
+	}, content, 0)
+	check(t, err == injected && n == 2, "writeAtFull should return the injected error: %v, %v", n, err)
+}
+
+func TestBufferedWriterClose(t *testing.T) {
+	injected := errors.New("injected write error")
+	w := newBufferedWriter(&failingWriter{n: 4, err: injected}, 4)
+
+	// Past the buffer boundary, the first chunk is flushed successfully and
+	// the rest stays buffered
+	for _, b := range []string{"123", "456"} {
+		n, err := w.Write([]byte(b))
+		check(t, err == nil && n == len(b), "Write: %v, %s", n, err)
+	}
+
+	err := w.Close()
+	check(t, err == injected, "Close should return the injected error, %v", err)
+
+	_, err = w.Write(data)
+	check(t, errors.Is(err, os.ErrClosed), "Write after Close should fail with ErrClosed, %v", err)
+}
+
+func TestBufferedWriter(t *testing.T) {
+	path := "/TestBufferedWriter"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	w := NewBufferedWriter(&f.Fd)
+	for i := 0; i < 3; i++ {
+		_, err = w.Write(data)
+		check(t, err == nil, "Write %q: %s", path, err)
+	}
+
+	size, err := f.Size()
+	check(t, err == nil, "Size %q: %s", path, err)
+	check(t, size == 0, "writes should be buffered, size %v", size)
+
+	err = w.Close()
+	check(t, err == nil, "Close %q: %s", path, err)
+
+	size, err = f.Size()
+	check(t, err == nil, "Size %q: %s", path, err)
+	check(t, size == int64(3*len(data)), "incorrect size after Close %v != %v", size, 3*len(data))
+}
+
+func TestBufferedWriterSize(t *testing.T) {
+	path := "/TestBufferedWriterSize"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	w := NewBufferedWriterSize(&f.Fd, 2*len(data))
+	for i := 0; i < 3; i++ {
+		_, err = w.Write(data)
+		check(t, err == nil, "Write %q: %s", path, err)
+	}
+
+	size, err := f.Size()
+	check(t, err == nil, "Size %q: %s", path, err)
+	check(t, size == int64(2*len(data)), "the full buffer should have been written, size %v", size)
+
+	err = w.Flush()
+	check(t, err == nil, "Flush %q: %s", path, err)
+
+	size, err = f.Size()
+	check(t, err == nil, "Size %q: %s", path, err)
+	check(t, size == int64(3*len(data)), "incorrect size after Flush %v != %v", size, 3*len(data))
+
+	err = w.Close()
+	check(t, err == nil, "Close %q: %s", path, err)
+}
+
+func TestFdStatvfs(t *testing.T) {
+	path := "/TestFdStatvfs"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	st, err := f.Statvfs()
+	check(t, err == nil, "Statvfs %q: %s", path, err)
+	check(t, st.BlockSize > 0, "BlockSize should be set")
+	check(t, st.BlocksFree <= st.Blocks, "more free blocks than blocks %v > %v", st.BlocksFree, st.Blocks)
+	check(t, st.BlocksAvail <= st.BlocksFree, "more available blocks than free %v > %v", st.BlocksAvail, st.BlocksFree)
+
+	var vbuf Statvfs_t
+	err = vol.Statvfs("/", &vbuf)
+	check(t, err == nil, "vol.Statvfs: %s", err)
+	check(t, st.Blocks == vbuf.Blocks, "Blocks differs from the volume %v != %v", st.Blocks, vbuf.Blocks)
+}
+
+func TestReopen(t *testing.T) {
+	path1, path2 := "/TestReopen1", "/TestReopen2"
+	f, err := vol.Create(path1)
+	check(t, err == nil, "Create %q: %s", path1, err)
+	defer vol.Unlink(path1)
+
+	err = vol.Reopen(f, path2, os.O_RDWR|os.O_CREATE, 0644)
+	check(t, err == ErrNotClosed, "Reopen of an open File should fail with ErrNotClosed, %v", err)
+
+	err = f.Close()
+	check(t, err == nil, "Close %q: %s", path1, err)
+
+	err = vol.Reopen(f, path2, os.O_RDWR|os.O_CREATE, 0644)
+	check(t, err == nil, "Reopen %q: %s", path2, err)
+	defer vol.Unlink(path2)
+	defer f.Close()
+
+	check(t, f.Name() == path2, "incorrect name after Reopen %q", f.Name())
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path2, err)
+
+	info, err := vol.Stat(path2)
+	check(t, err == nil, "Stat %q: %s", path2, err)
+	check(t, info.Size() == int64(len(data)), "write went to the wrong file, size %v", info.Size())
+
+	// Of concurrent Reopens only one wins, the others close the fd they opened
+	err = f.Close()
+	check(t, err == nil, "Close %q: %s", path2, err)
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- vol.Reopen(f, path1, os.O_RDONLY, 0)
+		}()
+	}
+	reopened := 0
+	for i := 0; i < cap(errs); i++ {
+		err := <-errs
+		check(t, err == nil || err == ErrNotClosed, "concurrent Reopen %q: %s", path1, err)
+		if err == nil {
+			reopened++
+		}
+	}
+	check(t, reopened == 1, "%v concurrent Reopens succeeded", reopened)
+	check(t, f.Name() == path1, "incorrect name after Reopen %q", f.Name())
+}
+
+func TestDeadline(t *testing.T) {
+	path := "/TestDeadline"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	err = f.SetWriteDeadline(time.Now().Add(-time.Second))
+	check(t, err == nil, "SetWriteDeadline %q: %s", path, err)
+	_, err = f.Fd.Write(data)
+	check(t, errors.Is(err, os.ErrDeadlineExceeded), "Write past the deadline should time out, %v", err)
+
+	err = f.SetWriteDeadline(time.Now().Add(time.Minute))
+	check(t, err == nil, "SetWriteDeadline %q: %s", path, err)
+	n, err := f.Fd.Write(data)
+	check(t, err == nil && n == len(data), "Write %q: %v, %s", path, n, err)
+
+	err = f.SetReadDeadline(time.Now().Add(time.Minute))
+	check(t, err == nil, "SetReadDeadline %q: %s", path, err)
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	buf := make([]byte, len(data))
+	n, err = f.Fd.Read(buf)
+	check(t, err == nil && n == len(data), "Read %q: %v, %s", path, n, err)
+	check(t, bytes.Equal(buf, data), "Read returned wrong data %q", buf)
+
+	err = f.SetReadDeadline(time.Time{})
+	check(t, err == nil, "SetReadDeadline %q: %s", path, err)
+
+	err = f.SetReadDeadline(time.Now().Add(time.Minute))
+	check(t, err == nil, "SetReadDeadline %q: %s", path, err)
+	err = f.Close()
+	check(t, err == nil, "Close %q: %s", path, err)
+	_, err = f.Fd.Read(buf)
+	check(t, err == ErrClosed, "Read with a deadline on a closed fd should fail with ErrClosed, %v", err)
+}
+
+func TestModeConversion(t *testing.T) {
+	modes := []os.FileMode{
+		0644,
+		0755 | os.ModeDir,
+		0777 | os.ModeSymlink,
+		0600 | os.ModeNamedPipe,
+		0600 | os.ModeSocket,
+		0660 | os.ModeDevice,
+		0660 | os.ModeDevice | os.ModeCharDevice,
+		0755 | os.ModeSetuid | os.ModeSetgid,
+		0777 | os.ModeDir | os.ModeSticky,
+	}
+	for _, m := range modes {
+		got := GlfsToMode(ModeToGlfs(m))
+		check(t, got == m, "mode %v doesn't round trip, got %v", m, got)
+	}
+
+	check(t, ModeToGlfs(0755|os.ModeDir) == syscall.S_IFDIR|0755, "incorrect raw mode %o", ModeToGlfs(0755|os.ModeDir))
+	check(t, GlfsToMode(syscall.S_IFREG|0644) == 0644, "incorrect mode %v", GlfsToMode(syscall.S_IFREG|0644))
+}
+
+func TestReadAtFull(t *testing.T) {
+	path := "/TestReadAtFull"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	buf := make([]byte, len(data))
+	n, err := f.ReadAtFull(buf, 0)
+	check(t, err == nil && n == len(data), "ReadAtFull %q: %v, %s", path, n, err)
+	check(t, bytes.Equal(buf, data), "ReadAtFull returned wrong data %q", buf)
+
+	n, err = f.ReadAtFull(buf, 1)
+	check(t, err == io.ErrUnexpectedEOF && n == len(data)-1, "ReadAtFull past the end should fail with ErrUnexpectedEOF, %v, %v", n, err)
+
+	n, err = f.ReadAtFull(buf, int64(len(data)))
+	check(t, err == io.EOF && n == 0, "ReadAtFull at the end should fail with EOF, %v, %v", n, err)
+}
+
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Logf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestLogger(t *testing.T) {
+	path := "/TestLogger"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	l := &recordingLogger{}
+	SetLogger(l)
+	_, err = f.Fd.Pwrite(data, 0, nil, nil)
+	SetLogger(nil)
+	check(t, err == nil, "Pwrite %q: %s", path, err)
+
+	_, err = f.Fd.Pwrite(data, 0, nil, nil)
+	check(t, err == nil, "Pwrite %q: %s", path, err)
+
+	want := fmt.Sprintf("gfapi: op=pwrite len=%d off=0 n=%d err=<nil>", len(data), len(data))
+	check(t, reflect.DeepEqual(l.lines, []string{want}), "incorrect log lines %q", l.lines)
+}
+
+func TestAppendFrame(t *testing.T) {
+	path := "/TestAppendFrame"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	header, payload := []byte{0, 4}, []byte("frame")
+	n, err := f.AppendFrame(header, payload)
+	check(t, err == nil, "AppendFrame %q: %s", path, err)
+	check(t, n == len(header)+len(payload), "AppendFrame wrote %v bytes", n)
+
+	buf := make([]byte, 64)
+	n, err = f.Fd.Pread(buf, 0, nil)
+	check(t, err == nil, "Pread %q: %s", path, err)
+	want := append(append(append([]byte{}, data...), header...), payload...)
+	check(t, bytes.Equal(buf[:n], want), "incorrect contents %q != %q", buf[:n], want)
+}
+
+func TestSection(t *testing.T) {
+	path := "/TestSection"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write([]byte("0123456789"))
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, err := io.ReadAll(f.Section(int64(2*i), 2))
+			want := fmt.Sprintf("%d%d", 2*i, 2*i+1)
+			if err != nil || string(got) != want {
+				t.Errorf("section %d: %q, %v, want %q", i, got, err, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestStatHardLinks(t *testing.T) {
+	file := &Stat{mode: syscall.S_IFREG | 0644, nlink: 2, ino: 7, devMajor: 1, devMinor: 3}
+	dir := &Stat{mode: syscall.S_IFDIR | 0755, nlink: 3, ino: 8, devMajor: 1, devMinor: 3}
+	link := &Stat{mode: syscall.S_IFREG | 0644, nlink: 2, ino: 7, devMajor: 1, devMinor: 3}
+
+	check(t, file.Nlink() == 2, "incorrect Nlink %v", file.Nlink())
+	check(t, file.IsHardLinked(), "file with 2 links should be hard linked")
+	check(t, !dir.IsHardLinked(), "directory should never be hard linked")
+	check(t, file.Key() == link.Key(), "links should have the same Key %q != %q", file.Key(), link.Key())
+	check(t, file.Key() != dir.Key(), "different inodes should have different Keys %q", file.Key())
+}
+
+func TestGetxattrAll(t *testing.T) {
+	path := "/TestGetxattrAll"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	attr, value := "user.TestGetxattrAll", []byte("a longer attribute value")
+	_, err = f.FgetxattrSize(attr)
+	check(t, err == ErrNoAttr, "FgetxattrSize of a missing attribute should fail with ErrNoAttr, %v", err)
+	_, err = f.GetxattrAll(attr)
+	check(t, errors.Is(err, ErrNoAttr), "GetxattrAll of a missing attribute should fail with ErrNoAttr, %v", err)
+
+	err = f.Setxattr(attr, value, 0)
+	check(t, err == nil, "Setxattr %q: %s", attr, err)
+
+	size, err := f.FgetxattrSize(attr)
+	check(t, err == nil && size == int64(len(value)), "FgetxattrSize %q: %v, %s", attr, size, err)
+
+	got, err := f.GetxattrAll(attr)
+	check(t, err == nil, "GetxattrAll %q: %s", attr, err)
+	check(t, bytes.Equal(got, value), "GetxattrAll returned wrong value %q", got)
+}
+
+func TestGetAllXattrs(t *testing.T) {
+	path := "/TestGetAllXattrs"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	want := map[string][]byte{
+		"user.TestGetAllXattrs.a": []byte("first"),
+		"user.TestGetAllXattrs.b": []byte("second value"),
+		"user.TestGetAllXattrs.c": []byte("3"),
+	}
+	for attr, value := range want {
+		err = f.Setxattr(attr, value, 0)
+		check(t, err == nil, "Setxattr %q: %s", attr, err)
+	}
+
+	names, err := f.ListxattrAll()
+	check(t, err == nil, "ListxattrAll %q: %s", path, err)
+	for attr := range want {
+		check(t, slices.Contains(names, attr), "ListxattrAll should list %q, %v", attr, names)
+	}
+
+	got, err := f.GetAllXattrs("user.TestGetAllXattrs.")
+	check(t, err == nil, "GetAllXattrs %q: %s", path, err)
+	check(t, reflect.DeepEqual(got, want), "GetAllXattrs returned %q", got)
+
+	got, err = f.GetAllXattrs("user.TestGetAllXattrs.b")
+	check(t, err == nil && len(got) == 1, "GetAllXattrs with a narrower prefix: %q, %s", got, err)
+}
+
+func TestACLEncoding(t *testing.T) {
+	acl := ACL{
+		{Tag: ACLUserObj, Perm: 6, ID: ACLUndefinedID},
+		{Tag: ACLUser, Perm: 4, ID: 1000},
+		{Tag: ACLGroupObj, Perm: 4, ID: ACLUndefinedID},
+		{Tag: ACLMask, Perm: 4, ID: ACLUndefinedID},
+		{Tag: ACLOther, Perm: 0, ID: ACLUndefinedID},
+	}
+
+	b := encodeACL(acl)
+	check(t, len(b) == 4+8*len(acl), "incorrect encoded length %v", len(b))
+	check(t, bytes.Equal(b[:12], []byte{2, 0, 0, 0, 1, 0, 6, 0, 0xff, 0xff, 0xff, 0xff}), "incorrect encoding % x", b[:12])
+
+	got, err := decodeACL(b)
+	check(t, err == nil, "decodeACL: %s", err)
+	check(t, reflect.DeepEqual(got, acl), "ACL doesn't round trip %v", got)
+
+	_, err = decodeACL(b[:len(b)-1])
+	check(t, err == ErrInvalidACL, "truncated ACL should fail with ErrInvalidACL, %v", err)
+	_, err = decodeACL([]byte{1, 0, 0, 0})
+	check(t, err == ErrInvalidACL, "unknown version should fail with ErrInvalidACL, %v", err)
+}
+
+func TestACL(t *testing.T) {
+	path := "/TestACL"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	acl := ACL{
+		{Tag: ACLUserObj, Perm: 6, ID: ACLUndefinedID},
+		{Tag: ACLUser, Perm: 4, ID: 1000},
+		{Tag: ACLGroupObj, Perm: 4, ID: ACLUndefinedID},
+		{Tag: ACLMask, Perm: 4, ID: ACLUndefinedID},
+		{Tag: ACLOther, Perm: 0, ID: ACLUndefinedID},
+	}
+	f.SetStatCaching(true)
+	_, err = f.Mode()
+	check(t, err == nil, "Mode %q: %s", path, err)
+	err = f.SetACL(acl)
+	check(t, err == nil, "SetACL %q: %s", path, err)
+
+	// The ACL changed the mode, the cached stat is dropped
+	mode, err := f.Mode()
+	check(t, err == nil && mode.Perm() == 0640, "Mode after SetACL: %v, %s", mode, err)
+
+	got, err := f.GetACL()
+	check(t, err == nil, "GetACL %q: %s", path, err)
+	check(t, reflect.DeepEqual(got, acl), "GetACL returned wrong ACL %v", got)
+}
+
+func TestFprint(t *testing.T) {
+	path := "/TestFprint"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	n, err := io.WriteString(&f.Fd, "")
+	check(t, err == nil && n == 0, "WriteString of an empty string: %v, %s", n, err)
+
+	_, err = fmt.Fprint(&f.Fd, "hello ", 42)
+	check(t, err == nil, "Fprint %q: %s", path, err)
+
+	buf := make([]byte, 64)
+	n, err = f.Fd.Pread(buf, 0, nil)
+	check(t, err == nil, "Pread %q: %s", path, err)
+	check(t, string(buf[:n]) == "hello 42", "incorrect contents %q", buf[:n])
+}
+
+func TestReadAtEOF(t *testing.T) {
+	path := "/TestReadAtEOF"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	size := int64(len(data))
+
+	buf := make([]byte, 2)
+	n, err := f.Fd.ReadAt(buf, size-2)
+	check(t, err == nil && n == 2, "ReadAt just before the end: %v, %v", n, err)
+
+	n, err = f.Fd.ReadAt(buf, size-1)
+	check(t, err == io.EOF && n == 1, "ReadAt across the end should return io.EOF: %v, %v", n, err)
+	check(t, buf[0] == data[size-1], "ReadAt across the end returned wrong data %q", buf[:n])
+
+	n, err = f.Fd.ReadAt(buf, size)
+	check(t, err == io.EOF && n == 0, "ReadAt at the end should return io.EOF: %v, %v", n, err)
+
+	n, err = f.Fd.ReadAt(buf, size+10)
+	check(t, err == io.EOF && n == 0, "ReadAt past the end should return io.EOF: %v, %v", n, err)
+
+	n, err = f.Fd.ReadAt(nil, size)
+	check(t, err == nil && n == 0, "empty ReadAt at the end: %v, %v", n, err)
+}
+
+func TestEnsureAllocated(t *testing.T) {
+	path := "/TestEnsureAllocated"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	err = f.EnsureAllocated(0, 1<<20)
+	check(t, err == nil, "EnsureAllocated %q: %s", path, err)
+
+	buf := make([]byte, len(data))
+	_, err = f.Fd.ReadAt(buf, 0)
+	check(t, err == nil, "ReadAt %q: %s", path, err)
+	check(t, bytes.Equal(buf, data), "EnsureAllocated overwrote the data %q", buf)
+
+	var stat syscall.Stat_t
+	err = f.Fstat(&stat)
+	check(t, err == nil, "Fstat %q: %s", path, err)
+	check(t, stat.Blocks*512 >= 1<<20, "range isn't allocated, %v blocks", stat.Blocks)
+
+	err = f.EnsureAllocated(-1, 10)
+	check(t, err == syscall.EINVAL, "negative offset should fail with EINVAL, %v", err)
+}
+
+func TestAllocateAndVerify(t *testing.T) {
+	path := "/TestAllocateAndVerify"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	const size = 1 << 20
+	blocks, err := f.AllocateAndVerify(size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOTSUP {
+		t.Skipf("fallocate not supported: %s", err)
+	}
+	check(t, err == nil, "AllocateAndVerify %q: %s", path, err)
+	check(t, blocks*512 >= size, "range isn't allocated, %v blocks", blocks)
+
+	fsize, err := f.Size()
+	check(t, err == nil && fsize == size, "Size after AllocateAndVerify %q: %v, %s", path, fsize, err)
+
+	_, err = f.AllocateAndVerify(-1)
+	check(t, err == syscall.EINVAL, "negative size should fail with EINVAL, %v", err)
+}
+
+func TestCounter(t *testing.T) {
+	path := "/TestCounter"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	c := NewCounter(&f.Fd)
+	for i := 0; i < 3; i++ {
+		_, err = c.Write(data)
+		check(t, err == nil, "Write %q: %s", path, err)
+	}
+	check(t, c.BytesWritten() == int64(3*len(data)), "incorrect BytesWritten %v", c.BytesWritten())
+
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	_, err = io.Copy(io.Discard, c)
+	check(t, err == nil, "Copy %q: %s", path, err)
+	check(t, c.BytesRead() == int64(3*len(data)), "incorrect BytesRead %v", c.BytesRead())
+}
+
+func TestDirectoryGuards(t *testing.T) {
+	dir, path := "/TestDirectoryGuards", "/TestDirectoryGuards/file"
+	err := vol.Mkdir(dir, 0755)
+	check(t, err == nil, "Mkdir %q: %s", dir, err)
+	defer vol.Rmdir(dir)
+
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Readdirnames(0)
+	check(t, err == ErrNotDirectory, "Readdirnames of a file should fail with ErrNotDirectory, %v", err)
+	_, err = f.Fd.Readdir(0)
+	check(t, errors.Is(err, syscall.ENOTDIR), "Readdir of a file should fail with ENOTDIR, %v", err)
+
+	d, err := vol.Open(dir)
+	check(t, err == nil, "Open %q: %s", dir, err)
+	defer d.Close()
+
+	_, err = d.Fd.Write(data)
+	check(t, err == ErrIsDirectory, "Write to a directory should fail with ErrIsDirectory, %v", err)
+	_, err = d.Fd.Pwrite(data, 0, nil, nil)
+	check(t, err == ErrIsDirectory, "Pwrite to a directory should fail with ErrIsDirectory, %v", err)
+	bufs := net.Buffers{data}
+	_, err = d.WriteBuffers(&bufs)
+	check(t, err == ErrIsDirectory, "WriteBuffers to a directory should fail with ErrIsDirectory, %v", err)
+	err = d.Fd.Ftruncate(0, nil, nil)
+	check(t, errors.Is(err, syscall.EISDIR), "Ftruncate of a directory should fail with EISDIR, %v", err)
+
+	names, err := d.Readdirnames(0)
+	check(t, err == nil, "Readdirnames %q: %s", dir, err)
+	check(t, len(names) == 3, "incorrect entries %q", names)
+}
+
+func TestPwriteSync(t *testing.T) {
+	path := "/TestPwriteSync"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	n, err := f.PwriteSync(data, 4)
+	check(t, err == nil && n == len(data), "PwriteSync %q: %v, %s", path, n, err)
+
+	buf := make([]byte, len(data))
+	_, err = f.Fd.ReadAt(buf, 4)
+	check(t, err == nil, "ReadAt %q: %s", path, err)
+	check(t, bytes.Equal(buf, data), "incorrect contents %q", buf)
+}
+
+func TestChecksum(t *testing.T) {
+	path := "/TestChecksum"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 100000)
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	h := crc32.NewIEEE()
+	n, err := f.Checksum(h, 0, 0)
+	check(t, err == nil && n == int64(len(content)), "Checksum %q: %v, %s", path, n, err)
+	check(t, h.Sum32() == crc32.ChecksumIEEE(content), "incorrect checksum of the whole file")
+
+	h.Reset()
+	n, err = f.Checksum(h, 5, 100)
+	check(t, err == nil && n == 100, "Checksum %q: %v, %s", path, n, err)
+	check(t, h.Sum32() == crc32.ChecksumIEEE(content[5:105]), "incorrect checksum of the range")
+}
+
+func TestReadWriteFlags(t *testing.T) {
+	path := "/TestReadWriteFlags"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	n, err := f.WriteFlags(data, WriteSync)
+	check(t, err == nil && n == len(data), "WriteFlags %q: %v, %s", path, n, err)
+	n, err = f.PwriteFlags(data, int64(len(data)), WriteDsync)
+	check(t, err == nil && n == len(data), "PwriteFlags %q: %v, %s", path, n, err)
+
+	buf := make([]byte, 2*len(data))
+	n, err = f.PreadFlags(buf, 0, 0)
+	check(t, err == nil && n == len(buf), "PreadFlags %q: %v, %s", path, n, err)
+	check(t, bytes.Equal(buf, append(append([]byte{}, data...), data...)), "incorrect contents %q", buf)
+
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	n, err = f.ReadFlags(buf, 0)
+	check(t, err == nil && n == len(buf), "ReadFlags %q: %v, %s", path, n, err)
+
+	// The flag variants are observed and honor the deadlines like Read and Write
+	var ops []string
+	SetMetricsObserver(func(op string, bytes int, dur time.Duration, err error) {
+		ops = append(ops, op)
+	})
+	defer SetMetricsObserver(nil)
+	_, err = f.WriteFlags(data, WriteSync)
+	check(t, err == nil, "WriteFlags %q: %s", path, err)
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	_, err = f.ReadFlags(buf, 0)
+	check(t, err == nil, "ReadFlags %q: %s", path, err)
+	check(t, reflect.DeepEqual(ops, []string{"write", "read"}), "incorrect observed ops %v", ops)
+	SetMetricsObserver(nil)
+
+	err = f.SetWriteDeadline(time.Now().Add(-time.Second))
+	check(t, err == nil, "SetWriteDeadline %q: %s", path, err)
+	_, err = f.WriteFlags(data, WriteSync)
+	check(t, errors.Is(err, os.ErrDeadlineExceeded), "WriteFlags past the deadline should time out, %v", err)
+	err = f.SetReadDeadline(time.Now().Add(-time.Second))
+	check(t, err == nil, "SetReadDeadline %q: %s", path, err)
+	_, err = f.ReadFlags(buf, 0)
+	check(t, errors.Is(err, os.ErrDeadlineExceeded), "ReadFlags past the deadline should time out, %v", err)
+}
+
+func TestReaderAtReader(t *testing.T) {
+	path := "/TestReaderAtReader"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	content := bytes.Repeat(data, 1000)
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := io.ReadAll(f.ReaderAtReader())
+			if err != nil || !bytes.Equal(got, content) {
+				t.Errorf("ReaderAtReader read %v bytes, %v", len(got), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	off, err := f.Offset()
+	check(t, err == nil, "Offset %q: %s", path, err)
+	check(t, off == int64(len(content)), "ReaderAtReader moved the offset of the Fd to %v", off)
+}
+
+func TestGlfsStatRoundTrip(t *testing.T) {
+	s := &Stat{
+		mask:     statBasicStats,
+		atime:    time.Date(2023, 5, 1, 10, 0, 0, 123456789, time.UTC),
+		ctime:    time.Date(2023, 5, 2, 10, 0, 0, 1, time.UTC),
+		mtime:    time.Date(2023, 5, 3, 10, 0, 0, 999999999, time.UTC),
+		ino:      42,
+		size:     4096,
+		blocks:   8,
+		blkksize: 4096,
+		nlink:    1,
+		uid:      1000,
+		gid:      1000,
+		mode:     syscall.S_IFREG | 0644,
+	}
+
+	got := FromGlfsStat(s.ToGlfsStat())
+	check(t, reflect.DeepEqual(got, s), "Stat doesn't round trip %+v != %+v", got, s)
+	check(t, got.btime.IsZero(), "unset btime should stay zero, %v", got.btime)
+	check(t, FromGlfsStat(nil) == nil, "FromGlfsStat of nil should be nil")
+
+	// A Stat from a struct stat has its times in UTC too
+	var st syscall.Stat_t
+	fromStat := statFromSyscall(&st)
+	check(t, fromStat.mtime.IsZero(), "an unset mtime should be zero, %v", fromStat.mtime)
+
+	path := "/TestGlfsStatRoundTrip"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+	err = f.Fstat(&st)
+	check(t, err == nil, "Fstat %q: %s", path, err)
+	fromStat = statFromSyscall(&st)
+	check(t, fromStat.mtime.Location() == time.UTC, "the mtime of a struct stat should be in UTC, %v", fromStat.mtime)
+}
+
+func TestReadOnly(t *testing.T) {
+	path := "/TestReadOnly"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	r, err := vol.Open(path)
+	check(t, err == nil, "Open %q: %s", path, err)
+	defer r.Close()
+
+	_, err = r.Fd.Write(data)
+	check(t, err == ErrReadOnly, "Write should fail with ErrReadOnly, %v", err)
+	_, err = r.Fd.Pwrite(data, 0, nil, nil)
+	check(t, err == ErrReadOnly, "Pwrite should fail with ErrReadOnly, %v", err)
+	err = r.Fd.Ftruncate(10, nil, nil)
+	check(t, err == ErrReadOnly, "Ftruncate should fail with ErrReadOnly, %v", err)
+	bufs := net.Buffers{data}
+	_, err = r.WriteBuffers(&bufs)
+	check(t, err == ErrReadOnly, "WriteBuffers should fail with ErrReadOnly, %v", err)
+	_, err = r.AppendFrame(data, data)
+	check(t, err == ErrReadOnly, "AppendFrame should fail with ErrReadOnly, %v", err)
+
+	q, err := NewIOQueue(&r.Fd, 1)
+	check(t, err == nil, "NewIOQueue: %s", err)
+	err = q.SubmitWrite(data, 0)
+	check(t, err == ErrReadOnly, "SubmitWrite should fail with ErrReadOnly, %v", err)
+	q.Close()
+	err = r.Fallocate(0, 0, 10)
+	check(t, errors.Is(err, syscall.EBADF), "Fallocate should fail with EBADF, %v", err)
+
+	w, err := vol.OpenFile(path, os.O_WRONLY, 0)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	defer w.Close()
+	_, err = w.Fd.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+}
+
+func TestReaderFailedRead(t *testing.T) {
+	path := "/TestReaderFailedRead"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	// Reads from a write-only fd fail in libgfapi, which returns -1
+	wo, err := vol.OpenFile(path, os.O_WRONLY, 0)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	defer wo.Close()
+
+	lr, err := NewLineReader(&wo.Fd)
+	check(t, err == nil, "NewLineReader %q: %s", path, err)
+	_, err = lr.ReadLine()
+	check(t, err != nil, "ReadLine from a write-only fd should fail")
+
+	rl, err := NewRateLimitedReader(&wo.Fd, 1<<20)
+	check(t, err == nil, "NewRateLimitedReader %q: %s", path, err)
+	buf := make([]byte, len(data))
+	for name, r := range map[string]io.Reader{
+		"Counter":           NewCounter(&wo.Fd),
+		"PositionedReader":  NewPositionedReader(&wo.Fd, 0),
+		"RateLimitedReader": rl,
+		"TeeReader":         TeeReader(&wo.Fd, &f.Fd),
+	} {
+		n, err := r.Read(buf)
+		check(t, err != nil && n == 0, "%s Read from a write-only fd: %v, %v", name, n, err)
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	path := "/TestLineReader"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	long := strings.Repeat("x", 100000)
+	_, err = f.WriteString("first\r\n" + long + "\nlast")
+	check(t, err == nil, "WriteString %q: %s", path, err)
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	r, err := NewLineReader(&f.Fd)
+	check(t, err == nil, "NewLineReader %q: %s", path, err)
+
+	line, err := r.ReadLine()
+	check(t, err == nil && string(line) == "first", "ReadLine: %q, %v", line, err)
+	line, err = r.ReadLine()
+	check(t, err == nil && string(line) == long, "ReadLine of a line longer than the buffer: %v bytes, %v", len(line), err)
+	line, err = r.ReadLine()
+	check(t, err == io.EOF && string(line) == "last", "ReadLine of the final partial line: %q, %v", line, err)
+	line, err = r.ReadLine()
+	check(t, err == io.EOF && line == nil, "ReadLine at the end: %q, %v", line, err)
+
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	r, err = NewLineReader(&f.Fd)
+	check(t, err == nil, "NewLineReader %q: %s", path, err)
+	str, err := r.ReadString('\r')
+	check(t, err == nil && str == "first\r", "ReadString: %q, %v", str, err)
+}
+
+func TestRemoveXattrs(t *testing.T) {
+	path := "/TestRemoveXattrs"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	attrs := []string{"user.TestRemoveXattrs1", "user.TestRemoveXattrs2"}
+	for _, attr := range attrs {
+		err = f.Setxattr(attr, data, 0)
+		check(t, err == nil, "Setxattr %q: %s", attr, err)
+	}
+
+	err = f.RemoveXattrs(append(attrs, "user.TestRemoveXattrsMissing"))
+	check(t, err == nil, "RemoveXattrs %q: %s", path, err)
+	for _, attr := range attrs {
+		_, err = f.FgetxattrSize(attr)
+		check(t, err == ErrNoAttr, "%q should have been removed, %v", attr, err)
+	}
+
+	err = f.RemoveXattrs([]string{"invalid.TestRemoveXattrs"})
+	check(t, err != nil && strings.Contains(err.Error(), "invalid.TestRemoveXattrs"), "RemoveXattrs of an invalid attribute should fail naming it, %v", err)
+}
+
+func TestCopySparse(t *testing.T) {
+	src, dst := "/TestCopySparseSrc", "/TestCopySparseDst"
+	f, err := vol.Create(src)
+	check(t, err == nil, "Create %q: %s", src, err)
+	defer vol.Unlink(src)
+	defer f.Close()
+
+	g, err := vol.Create(dst)
+	check(t, err == nil, "Create %q: %s", dst, err)
+	defer vol.Unlink(dst)
+	defer g.Close()
+
+	const size = 8 << 20
+	_, err = f.Fd.Pwrite(data, 0, nil, nil)
+	check(t, err == nil, "Pwrite %q: %s", src, err)
+	_, err = f.Fd.Pwrite(data, 4<<20, nil, nil)
+	check(t, err == nil, "Pwrite %q: %s", src, err)
+	err = f.Fd.Ftruncate(size, nil, nil)
+	check(t, err == nil, "Ftruncate %q: %s", src, err)
+
+	err = f.CopySparse(&g.Fd, size)
+	check(t, err == nil, "CopySparse %q: %s", src, err)
+
+	var st syscall.Stat_t
+	err = g.Fstat(&st)
+	check(t, err == nil, "Fstat %q: %s", dst, err)
+	check(t, st.Size == size, "incorrect size of the copy %v", st.Size)
+	check(t, st.Blocks*512 < size, "the holes weren't preserved, %v blocks", st.Blocks)
+
+	buf := make([]byte, len(data))
+	for _, off := range []int64{0, 4 << 20} {
+		_, err = g.Fd.ReadAt(buf, off)
+		check(t, err == nil, "ReadAt %q: %s", dst, err)
+		check(t, bytes.Equal(buf, data), "incorrect data at %v: %q", off, buf)
+	}
+
+	// A length past the end of the source is capped to its size
+	err = g.Ftruncate(0, nil, nil)
+	check(t, err == nil, "Ftruncate %q: %s", dst, err)
+	err = f.CopySparse(&g.Fd, 2*size)
+	check(t, err == nil, "CopySparse %q: %s", src, err)
+	err = g.Fstat(&st)
+	check(t, err == nil, "Fstat %q: %s", dst, err)
+	check(t, st.Size == size, "the copy should not be larger than the source, %v", st.Size)
+}
+
+func TestReaddirFunc(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer d.Close()
+
+	var names []string
+	err = d.ReaddirFunc(func(info os.FileInfo) error {
+		if info.Name() == "dir" {
+			return fmt.Errorf("entry %q: %w", info.Name(), SkipEntry)
+		}
+		names = append(names, info.Name())
+		return nil
+	})
+	check(t, err == nil, "ReaddirFunc %q: %s", tmpDir, err)
+	sort.Strings(names)
+	check(t, reflect.DeepEqual(names, []string{".", "..", "file"}), "incorrect entries %q", names)
+
+	e, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer e.Close()
+
+	stop := errors.New("stop")
+	calls := 0
+	err = e.ReaddirFunc(func(info os.FileInfo) error {
+		calls++
+		return stop
+	})
+	check(t, err == stop && calls == 1, "ReaddirFunc should stop at the first error, %v after %v calls", err, calls)
+}
+
+func TestXattrUint64(t *testing.T) {
+	path := "/TestXattrUint64"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	attr := "user.TestXattrUint64"
+	err = f.SetxattrUint64(attr, 0x0102030405060708, binary.BigEndian, 0)
+	check(t, err == nil, "SetxattrUint64 %q: %s", attr, err)
+
+	raw, err := f.GetxattrAll(attr)
+	check(t, err == nil, "GetxattrAll %q: %s", attr, err)
+	check(t, bytes.Equal(raw, []byte{1, 2, 3, 4, 5, 6, 7, 8}), "incorrect encoding % x", raw)
+
+	v, err := f.GetxattrUint64(attr, binary.BigEndian)
+	check(t, err == nil && v == 0x0102030405060708, "GetxattrUint64 %q: %x, %s", attr, v, err)
+	v, err = f.GetxattrUint64(attr, binary.LittleEndian)
+	check(t, err == nil && v == 0x0807060504030201, "GetxattrUint64 %q: %x, %s", attr, v, err)
+
+	err = f.Setxattr(attr, data, 0)
+	check(t, err == nil, "Setxattr %q: %s", attr, err)
+	_, err = f.GetxattrUint64(attr, binary.BigEndian)
+	check(t, err != nil, "GetxattrUint64 of a 4 byte value should fail")
+}
+
+func TestFgetxattrInto(t *testing.T) {
+	path := "/TestFgetxattrInto"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	attr, value := "user.TestFgetxattrInto", []byte("value")
+	_, _, err = f.FgetxattrInto(attr, make([]byte, 16))
+	check(t, err == ErrNoAttr, "FgetxattrInto of a missing attribute should fail with ErrNoAttr, %v", err)
+
+	err = f.Setxattr(attr, value, 0)
+	check(t, err == nil, "Setxattr %q: %s", attr, err)
+
+	buf := make([]byte, 16)
+	n, truncated, err := f.FgetxattrInto(attr, buf)
+	check(t, err == nil && !truncated, "FgetxattrInto %q: %v, %s", attr, truncated, err)
+	check(t, bytes.Equal(buf[:n], value), "FgetxattrInto returned wrong value %q", buf[:n])
+
+	for _, size := range []int{0, 2} {
+		n, truncated, err = f.FgetxattrInto(attr, buf[:size])
+		check(t, err == nil && truncated && n == 0, "FgetxattrInto into %d bytes: %v, %v, %s", size, n, truncated, err)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		f.FgetxattrInto(attr, buf)
+	})
+	check(t, allocs == 0, "FgetxattrInto should not allocate, %v allocations", allocs)
+}
+
+func TestWriteAtSparse(t *testing.T) {
+	path := "/TestWriteAtSparse"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	const off = 1 << 20
+	n, err := f.WriteAt(data, off, nil, nil)
+	check(t, err == nil && n == len(data), "WriteAt %q: %v, %s", path, n, err)
+
+	var st syscall.Stat_t
+	err = f.Fstat(&st)
+	check(t, err == nil, "Fstat %q: %s", path, err)
+	check(t, st.Size == off+int64(len(data)), "incorrect size %v != %v", st.Size, off+len(data))
+	check(t, st.Blocks*512 < off, "the gap should be a hole, %v blocks", st.Blocks)
+
+	buf := make([]byte, 512)
+	_, err = f.Fd.ReadAt(buf, 4096)
+	check(t, err == nil, "ReadAt %q: %s", path, err)
+	check(t, bytes.Equal(buf, make([]byte, 512)), "the hole should read as zeros")
+}
+
+func TestStatFileType(t *testing.T) {
+	tests := []struct {
+		mode                                     uint32
+		dir, regular, symlink, device, namedPipe bool
+	}{
+		{syscall.S_IFDIR | 0755, true, false, false, false, false},
+		{syscall.S_IFREG | 0644, false, true, false, false, false},
+		{syscall.S_IFLNK | 0777, false, false, true, false, false},
+		{syscall.S_IFBLK | 0660, false, false, false, true, false},
+		{syscall.S_IFCHR | 0660, false, false, false, true, false},
+		{syscall.S_IFIFO | 0600, false, false, false, false, true},
+		{syscall.S_IFSOCK | 0600, false, false, false, false, false},
+	}
+	for _, tt := range tests {
+		s := &Stat{mode: tt.mode}
+		got := []bool{s.IsDir(), s.IsRegular(), s.IsSymlink(), s.IsDevice(), s.IsNamedPipe()}
+		want := []bool{tt.dir, tt.regular, tt.symlink, tt.device, tt.namedPipe}
+		check(t, reflect.DeepEqual(got, want), "mode %o: got %v, want %v", tt.mode, got, want)
+	}
+}
+
+func TestReadN(t *testing.T) {
+	path := "/TestReadN"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	buf := make([]byte, len(data)-1)
+	n, err := f.ReadN(buf)
+	check(t, err == nil && n == len(buf), "ReadN %q: %v, %s", path, n, err)
+	check(t, bytes.Equal(buf, data[:len(buf)]), "ReadN returned wrong data %q", buf)
+
+	n, err = f.ReadN(buf)
+	check(t, err == io.ErrUnexpectedEOF && n == 1, "ReadN past the end should fail with ErrUnexpectedEOF, %v, %v", n, err)
+
+	n, err = f.ReadN(buf)
+	check(t, err == io.EOF && n == 0, "ReadN at the end should fail with EOF, %v, %v", n, err)
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := Capabilities()
+	check(t, Capabilities() == caps, "Capabilities should not change")
+
+	path := "/TestCapabilities"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	err = f.zerofill(0, 4096)
+	if caps.Zerofill {
+		check(t, err == nil, "zerofill %q: %s", path, err)
+	} else {
+		check(t, err == ErrNotSupported, "zerofill without glfs_zerofill should fail with ErrNotSupported, %v", err)
+	}
+}
+
+func TestPositionedReader(t *testing.T) {
+	path := "/TestPositionedReader"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write([]byte("0123456789"))
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	r := NewPositionedReader(&f.Fd, 2)
+	buf := make([]byte, 3)
+	n, err := r.Read(buf)
+	check(t, err == nil && string(buf[:n]) == "234", "Read: %q, %v", buf[:n], err)
+	check(t, r.Offset() == 5, "incorrect offset %v", r.Offset())
+
+	off, err := r.Seek(-2, SeekEnd)
+	check(t, err == nil && off == 8, "Seek: %v, %v", off, err)
+	rest, err := io.ReadAll(r)
+	check(t, err == nil && string(rest) == "89", "ReadAll: %q, %v", rest, err)
+
+	fdOff, err := f.Offset()
+	check(t, err == nil && fdOff == 10, "PositionedReader moved the offset of the Fd to %v, %v", fdOff, err)
+}
+
+func TestReplaceContents(t *testing.T) {
+	src, dst := "/TestReplaceContentsSrc", "/TestReplaceContentsDst"
+	f, err := vol.Create(src)
+	check(t, err == nil, "Create %q: %s", src, err)
+	defer vol.Unlink(src)
+	defer f.Close()
+
+	g, err := vol.Create(dst)
+	check(t, err == nil, "Create %q: %s", dst, err)
+	defer vol.Unlink(dst)
+	defer g.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", src, err)
+	_, err = g.Write(bytes.Repeat([]byte("old contents"), 10))
+	check(t, err == nil, "Write %q: %s", dst, err)
+
+	err = g.ReplaceContents(&f.Fd)
+	check(t, err == nil, "ReplaceContents %q: %s", dst, err)
+
+	got, err := io.ReadAll(g.ReaderAtReader())
+	check(t, err == nil, "ReadAll %q: %s", dst, err)
+	check(t, bytes.Equal(got, data), "incorrect contents %q", got)
+}
+
+func TestStatString(t *testing.T) {
+	s := &Stat{
+		mode:  syscall.S_IFDIR | syscall.S_ISVTX | 0755,
+		nlink: 2,
+		uid:   1000,
+		gid:   100,
+		size:  4096,
+		mtime: time.Date(2023, 5, 3, 10, 4, 5, 0, time.UTC),
+	}
+	want := "drwxr-xr-t 2 1000 100 4096 2023-05-03 10:04:05"
+	check(t, s.String() == want, "incorrect String %q != %q", s.String(), want)
+
+	s = &Stat{mode: syscall.S_IFREG | syscall.S_ISUID | 0644}
+	check(t, s.String() == "-rwSr--r-- 0 0 0 0 -", "incorrect String %q", s.String())
+
+	check(t, (&Stat{}).String() == "?--------- 0 0 0 0 -", "incorrect String of the zero Stat %q", (&Stat{}).String())
+	check(t, (*Stat)(nil).String() == "<nil>", "incorrect String of a nil Stat")
+}
+
+func TestCachingReaderAt(t *testing.T) {
+	path := "/TestCachingReaderAt"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write([]byte("0123456789"))
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	c, err := NewCachingReaderAt(&f.Fd, 4, 2)
+	check(t, err == nil, "NewCachingReaderAt %q: %s", path, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			buf := make([]byte, 3)
+			n, err := c.ReadAt(buf, off)
+			want := "0123456789"[off : off+3]
+			if err != nil || string(buf[:n]) != want {
+				t.Errorf("ReadAt %v: %q, %v, want %q", off, buf[:n], err, want)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	buf := make([]byte, 4)
+	n, err := c.ReadAt(buf, 8)
+	check(t, err == io.EOF && string(buf[:n]) == "89", "ReadAt across the end: %q, %v", buf[:n], err)
+
+	n, err = c.ReadAt(buf[:2], 0)
+	check(t, err == nil && string(buf[:n]) == "01", "ReadAt: %q, %v", buf[:n], err)
+	_, err = f.Fd.Pwrite([]byte("ab"), 0, nil, nil)
+	check(t, err == nil, "Pwrite %q: %s", path, err)
+	n, err = c.ReadAt(buf[:2], 0)
+	check(t, err == nil && string(buf[:n]) == "01", "ReadAt should be served from the cache: %q, %v", buf[:n], err)
+
+	c.Invalidate()
+	n, err = c.ReadAt(buf[:2], 0)
+	check(t, err == nil && string(buf[:n]) == "ab", "ReadAt after Invalidate: %q, %v", buf[:n], err)
+}
+
+func TestFchmodPrev(t *testing.T) {
+	path := "/TestFchmodPrev"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	err = f.Fchmod(0640)
+	check(t, err == nil, "Fchmod %q: %s", path, err)
+
+	old, err := f.FchmodPrev(0600)
+	check(t, err == nil && old == 0640, "FchmodPrev %q: %o, %s", path, old, err)
+
+	old, err = f.FchmodPrev(0644)
+	check(t, err == nil && old == 0600, "FchmodPrev %q: %o, %s", path, old, err)
+}
+
+func TestExtractRange(t *testing.T) {
+	path := "/TestExtractRange"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 50000)
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	var buf bytes.Buffer
+	n, err := f.ExtractRange(&buf, 3, 300000)
+	check(t, err == nil && n == 300000, "ExtractRange %q: %v, %s", path, n, err)
+	check(t, bytes.Equal(buf.Bytes(), content[3:300003]), "ExtractRange wrote wrong data")
+
+	buf.Reset()
+	n, err = f.ExtractRange(&buf, int64(len(content))-5, 100)
+	check(t, err == nil && n == 5, "ExtractRange across the end %q: %v, %s", path, n, err)
+	check(t, buf.String() == "56789", "ExtractRange across the end wrote %q", buf.String())
+}
+
+func TestCloseIdempotent(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = d.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	closed := 0
+	for _, err := range errs {
+		if err == nil {
+			closed++
+			continue
+		}
+		check(t, err == ErrClosed, "Close after Close should fail with ErrClosed, %v", err)
+	}
+	check(t, closed == 1, "the directory should be closed exactly once, %v", closed)
+
+	var nilFile *File
+	check(t, nilFile.Close() == os.ErrInvalid, "Close of a nil File should fail with ErrInvalid")
+}
+
+func TestTruncateGrowReadsZeros(t *testing.T) {
+	path := "/TestTruncateGrowReadsZeros"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	const size = 1 << 20
+	err = f.Fd.Ftruncate(size, nil, nil)
+	check(t, err == nil, "Ftruncate %q: %s", path, err)
+
+	buf := make([]byte, size-len(data))
+	n, err := f.Fd.ReadAt(buf, int64(len(data)))
+	check(t, err == nil && n == len(buf), "ReadAt of the grown region %q: %v, %s", path, n, err)
+	check(t, bytes.Equal(buf, make([]byte, len(buf))), "the grown region should read as zeros")
+
+	n, err = f.Fd.ReadAt(buf[:1], size)
+	check(t, err == io.EOF && n == 0, "ReadAt at the new end should return io.EOF: %v, %v", n, err)
+}
+
+func TestReaddirMode(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	for _, withStat := range []bool{true, false} {
+		d, err := vol.Open(tmpDir)
+		check(t, err == nil, "Open %q: %s", tmpDir, err)
+
+		entries, err := d.ReaddirMode(0, withStat)
+		d.Close()
+		check(t, err == nil, "ReaddirMode %q: %s", tmpDir, err)
+		check(t, len(entries) == 4, "incorrect number of entries %v", len(entries))
+
+		for _, e := range entries {
+			switch e.Name() {
+			case "dir":
+				check(t, e.FileType() == TypeDir && e.IsDir(), "incorrect type of %q: %v", e.Name(), e.FileType())
+			case "file":
+				check(t, e.FileType() == TypeRegular && e.Type() == 0, "incorrect type of %q: %v", e.Name(), e.FileType())
+			}
+			check(t, (e.Stat() != nil) == withStat, "Stat of %q with withStat %v: %v", e.Name(), withStat, e.Stat())
+
+			info, err := e.Info()
+			if withStat {
+				check(t, err == nil && info.Name() == e.Name(), "Info of %q: %v, %s", e.Name(), info, err)
+			} else {
+				check(t, errors.Is(err, ErrNotSupported), "Info of %q read without its stat should fail with ErrNotSupported, %v", e.Name(), err)
+			}
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		spec  string
+		flags int
+	}{
+		{"r", O_RDONLY},
+		{"w", O_WRONLY},
+		{"rw", O_RDWR},
+		{"wr", O_RDWR},
+		{"a", O_WRONLY | O_APPEND},
+		{"rac", O_RDWR | O_APPEND | O_CREATE},
+		{"wcxt", O_WRONLY | O_CREATE | O_EXCL | O_TRUNC},
+		{"ws", O_WRONLY | O_SYNC},
+	}
+	for _, tt := range tests {
+		flags, err := ParseFlags(tt.spec)
+		check(t, err == nil && flags == tt.flags, "ParseFlags %q: %#x, %v, want %#x", tt.spec, flags, err, tt.flags)
+	}
+
+	for _, spec := range []string{"", "c", "rq"} {
+		_, err := ParseFlags(spec)
+		check(t, err != nil, "ParseFlags %q should fail", spec)
+	}
+}
+
+func TestSyncGroup(t *testing.T) {
+	path := "/TestSyncGroup"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	var mu sync.Mutex
+	var fsyncs int
+	SetMetricsObserver(func(op string, bytes int, dur time.Duration, err error) {
+		if op == "fsync" {
+			mu.Lock()
+			fsyncs++
+			mu.Unlock()
+		}
+	})
+	defer SetMetricsObserver(nil)
+
+	g := NewSyncGroup(50 * time.Millisecond)
+
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := f.Fd.Pwrite(data, int64(i*len(data)), nil, nil); err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = g.WaitSync(&f.Fd)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		check(t, err == nil, "writer %d: %s", i, err)
+	}
+	check(t, fsyncs >= 1 && fsyncs < writers, "the fsyncs should be coalesced, %v fsyncs", fsyncs)
+}
+
+func TestReaddirSymlink(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	target := "file"
+	link := filepath.Join(tmpDir, "link")
+	err := vol.Symlink(target, link)
+	check(t, err == nil, "Symlink %q: %s", link, err)
+	defer vol.Unlink(link)
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer d.Close()
+
+	infos, err := d.Readdir(0)
+	check(t, err == nil, "Readdir %q: %s", tmpDir, err)
+
+	found := false
+	for _, info := range infos {
+		if info.Name() != "link" {
+			continue
+		}
+		found = true
+		check(t, info.Mode()&os.ModeSymlink != 0, "link should have ModeSymlink, %v", info.Mode())
+		check(t, info.Size() == int64(len(target)), "link should have the size of its target name, %v", info.Size())
+	}
+	check(t, found, "Readdir %q should return the link", tmpDir)
+
+	info, err := vol.Lstat(link)
+	check(t, err == nil, "Lstat %q: %s", link, err)
+	check(t, info.Mode()&os.ModeSymlink != 0 && info.Size() == int64(len(target)), "incorrect Lstat of link %v %v", info.Mode(), info.Size())
+}
+
+func TestRateLimited(t *testing.T) {
+	path := "/TestRateLimited"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	const rate = 32 << 10
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4<<10)
+
+	_, err = NewRateLimitedWriter(&f.Fd, 0)
+	check(t, err == syscall.EINVAL, "NewRateLimitedWriter with no rate should fail with EINVAL, %v", err)
+
+	w, err := NewRateLimitedWriter(&f.Fd, rate)
+	check(t, err == nil, "NewRateLimitedWriter: %s", err)
+	start := time.Now()
+	n, err := w.Write(content)
+	check(t, err == nil && n == len(content), "Write %q: %v, %s", path, n, err)
+	check(t, time.Since(start) >= 900*time.Millisecond, "Write of 64KiB at 32KiB/s took only %v", time.Since(start))
+
+	_, err = f.Seek(0, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	r, err := NewRateLimitedReader(&f.Fd, rate)
+	check(t, err == nil, "NewRateLimitedReader: %s", err)
+	start = time.Now()
+	got, err := io.ReadAll(r)
+	check(t, err == nil && bytes.Equal(got, content), "ReadAll %q: %v, %s", path, len(got), err)
+	check(t, time.Since(start) >= 900*time.Millisecond, "ReadAll of 64KiB at 32KiB/s took only %v", time.Since(start))
+}
+
+func TestReadAllCapped(t *testing.T) {
+	path := "/TestReadAllCapped"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	got, err := f.ReadAllCapped(int64(len(content)))
+	check(t, err == nil && bytes.Equal(got, content), "ReadAllCapped %q: %v, %s", path, len(got), err)
+	check(t, len(got) == cap(got), "ReadAllCapped should allocate the exact size, %v != %v", len(got), cap(got))
+
+	_, err = f.ReadAllCapped(int64(len(content)) - 1)
+	check(t, errors.Is(err, ErrTooLarge), "ReadAllCapped under the size should fail with ErrTooLarge, %v", err)
+
+	off, err := f.Offset()
+	check(t, err == nil && off == int64(len(content)), "ReadAllCapped should not move the offset, %v, %s", off, err)
+}
+
+func TestRemaining(t *testing.T) {
+	path := "/TestRemaining"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	content := []byte("0123456789")
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	for _, off := range []int64{0, 3, 10, 20} {
+		_, err = f.Seek(off, SeekStart)
+		check(t, err == nil, "Seek %q: %s", path, err)
+
+		n, err := f.Remaining()
+		check(t, err == nil && n == max(int64(len(content))-off, 0), "Remaining at %v: %v, %s", off, n, err)
+
+		cur, err := f.Offset()
+		check(t, err == nil && cur == off, "Remaining should not move the offset, %v != %v", cur, off)
+	}
+}
+
+func TestStatCaching(t *testing.T) {
+	path := "/TestStatCaching"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	other, err := vol.OpenFile(path, os.O_WRONLY, 0)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	defer other.Close()
+
+	f.SetStatCaching(true)
+	size, err := f.Size()
+	check(t, err == nil && size == 0, "Size %q: %v, %s", path, size, err)
+	mode, err := f.Mode()
+	check(t, err == nil && mode.IsRegular(), "Mode %q: %v, %s", path, mode, err)
+
+	// A write through another Fd isn't noticed until the stat is invalidated
+	_, err = other.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	size, err = f.Size()
+	check(t, err == nil && size == 0, "Size should be cached, %v, %s", size, err)
+
+	f.InvalidateStat()
+	size, err = f.Size()
+	check(t, err == nil && size == int64(len(data)), "Size after InvalidateStat: %v, %s", size, err)
+
+	// A truncate through the Fd invalidates the stat
+	err = f.Fd.Ftruncate(1, nil, nil)
+	check(t, err == nil, "Ftruncate %q: %s", path, err)
+	size, err = f.Size()
+	check(t, err == nil && size == 1, "Size after Ftruncate: %v, %s", size, err)
+
+	// Without caching every call is fresh
+	f.SetStatCaching(false)
+	_, err = other.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	size, err = f.Size()
+	check(t, err == nil && size == int64(2*len(data)), "Size without caching: %v, %s", size, err)
+
+	// A stat racing with the writes through the Fd is never left cached
+	f.SetStatCaching(true)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			f.Write(data)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			f.Size()
+		}
+	}()
+	wg.Wait()
+	var stat syscall.Stat_t
+	err = f.Fd.Fstat(&stat)
+	check(t, err == nil, "Fstat %q: %s", path, err)
+	size, err = f.Size()
+	check(t, err == nil && size == stat.Size, "Size after concurrent writes: %v, want %v, %s", size, stat.Size, err)
+}
+
+func TestReaddirStatBtime(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer d.Close()
+
+	entries, err := d.ReaddirStat(0)
+	check(t, err == nil, "ReaddirStat %q: %s", tmpDir, err)
+	for _, e := range entries {
+		st := e.Stat()
+		check(t, st.mask&statBtime == 0 && st.btime.IsZero(), "btime of %q should be unset, mask %#x", e.Name(), st.mask)
+	}
+}
+
+// osFile is the part of the method set of *os.File which GlusterFile provides
+type osFile interface {
+	io.ReadWriteSeeker
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+	Sync() error
+}
+
+var (
+	_ osFile = (*os.File)(nil)
+	_ osFile = (*GlusterFile)(nil)
+)
+
+func TestGlusterFile(t *testing.T) {
+	path := "/TestGlusterFile"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+
+	var g osFile = NewGlusterFile(f)
+	check(t, g.Name() == path, "incorrect Name %q", g.Name())
+
+	_, err = g.Write([]byte("0123456789"))
+	check(t, err == nil, "Write %q: %s", path, err)
+	_, err = g.WriteAt([]byte("ab"), 2)
+	check(t, err == nil, "WriteAt %q: %s", path, err)
+	err = g.Sync()
+	check(t, err == nil, "Sync %q: %s", path, err)
+
+	_, err = g.Seek(0, io.SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+	got, err := io.ReadAll(g)
+	check(t, err == nil && string(got) == "01ab456789", "ReadAll %q: %q, %s", path, got, err)
+
+	err = g.Truncate(4)
+	check(t, err == nil, "Truncate %q: %s", path, err)
+	fi, err := g.Stat()
+	check(t, err == nil && fi.Size() == 4, "Stat %q: %v, %s", path, fi, err)
+
+	err = g.Close()
+	check(t, err == nil, "Close %q: %s", path, err)
+	check(t, g.Close() == ErrClosed, "Close after Close should fail with ErrClosed")
+}
+
+func TestReaddirContext(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer d.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	infos, err := d.ReaddirContext(ctx, 1)
+	check(t, err == nil && len(infos) == 1, "ReaddirContext %q: %v, %s", tmpDir, len(infos), err)
+
+	cancel()
+	infos, err = d.ReaddirContext(ctx, 0)
+	check(t, err == context.Canceled && len(infos) == 0, "ReaddirContext with a cancelled context: %v, %v", len(infos), err)
+
+	d2, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer d2.Close()
+
+	infos, err = d2.ReaddirContext(context.Background(), 0)
+	check(t, err == nil && len(infos) == 4, "ReaddirContext %q: %v, %s", tmpDir, len(infos), err)
+}
+
+func TestLargeOffset(t *testing.T) {
+	path := "/TestLargeOffset"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	// Past 4GB, so a 32-bit offset would wrap around to a small one. The file
+	// is sparse, only the written bytes are allocated.
+	const off = 5<<30 + 3
+	n, err := f.Fd.WriteAt(data, off)
+	check(t, err == nil && n == len(data), "WriteAt %q at %v: %v, %s", path, off, n, err)
+
+	size, err := f.Size()
+	check(t, err == nil && size == off+int64(len(data)), "Size %q: %v, %s", path, size, err)
+
+	buf := make([]byte, len(data))
+	n, err = f.Fd.ReadAt(buf, off)
+	check(t, err == nil && bytes.Equal(buf, data), "ReadAt %q at %v: %q, %s", path, off, buf[:n], err)
+
+	n, err = f.Fd.ReadAt(buf, off-5<<30)
+	check(t, err == nil && bytes.Equal(buf, make([]byte, len(data))), "the start of the file should be a hole, %q, %s", buf[:n], err)
+}
+
+func TestCopyWithRetry(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = 0
+
+	content := []byte("0123456789")
+	// flakyReadAt reads 4 bytes at most, failing with errs first
+	flakyReadAt := func(errs ...error) func([]byte, int64) (int, error) {
+		return func(b []byte, off int64) (int, error) {
+			if len(errs) > 0 {
+				err := errs[0]
+				errs = errs[1:]
+				return -1, err
+			}
+			if off >= int64(len(content)) {
+				return 0, nil
+			}
+			return copy(b[:min(len(b), 4)], content[off:]), nil
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := copyWithRetry(&buf, flakyReadAt(syscall.EAGAIN, syscall.ENOTCONN), 0, make([]byte, 8), 2)
+	check(t, err == nil && n == int64(len(content)), "copyWithRetry with transient errors: %v, %s", n, err)
+	check(t, bytes.Equal(buf.Bytes(), content), "copyWithRetry wrote %q", buf.Bytes())
+
+	buf.Reset()
+	_, err = copyWithRetry(&buf, flakyReadAt(syscall.EAGAIN, syscall.EAGAIN), 0, make([]byte, 8), 1)
+	check(t, err == syscall.EAGAIN, "copyWithRetry past the retries should fail with EAGAIN, %v", err)
+
+	buf.Reset()
+	n, err = copyWithRetry(&buf, flakyReadAt(syscall.EIO), 0, make([]byte, 8), 5)
+	check(t, err == syscall.EIO && n == 0, "copyWithRetry should not retry EIO: %v, %v", n, err)
+
+	SetRetryableErrnos(syscall.EIO)
+	defer SetRetryableErrnos()
+	check(t, reflect.DeepEqual(RetryableErrnos(), []syscall.Errno{syscall.EIO}), "incorrect RetryableErrnos %v", RetryableErrnos())
+
+	buf.Reset()
+	n, err = copyWithRetry(&buf, flakyReadAt(syscall.EIO), 0, make([]byte, 8), 5)
+	check(t, err == nil && n == int64(len(content)), "copyWithRetry should retry EIO once configured: %v, %v", n, err)
+
+	retryBackoff = 100 * time.Millisecond
+	check(t, retryDelay(1) == 2*retryBackoff, "incorrect retryDelay %v", retryDelay(1))
+	for _, failures := range []int{36, 64, 1000} {
+		check(t, retryDelay(failures) == maxRetryBackoff, "retryDelay after %v failures should be capped, %v", failures, retryDelay(failures))
+	}
+
+	defaults := DefaultRetryableErrnos()
+	defaults[0] = syscall.EIO
+	check(t, reflect.DeepEqual(DefaultRetryableErrnos(), []syscall.Errno{syscall.EAGAIN, syscall.ENOTCONN}),
+		"DefaultRetryableErrnos should return a copy, %v", DefaultRetryableErrnos())
+}
+
+func TestCopyToWithRetry(t *testing.T) {
+	path := "/TestCopyToWithRetry"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 50000)
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", path, err)
+	_, err = f.Seek(10, SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	var buf bytes.Buffer
+	n, err := f.CopyToWithRetry(&buf, 3)
+	check(t, err == nil && n == int64(len(content)-10), "CopyToWithRetry %q: %v, %s", path, n, err)
+	check(t, bytes.Equal(buf.Bytes(), content[10:]), "CopyToWithRetry wrote wrong data")
+
+	off, err := f.Offset()
+	check(t, err == nil && off == int64(len(content)), "the offset should be past the copied bytes, %v, %s", off, err)
+}
+
+func TestStatHas(t *testing.T) {
+	s := NewStat(WithSize(0), WithMtime(time.Unix(0, 0)))
+	check(t, s.Has(StatSize) && s.Has(StatMtime), "Stat should have its size and mtime, mask %#x", s.mask)
+	check(t, !s.Has(StatBtime) && !s.Has(StatUid), "Stat should not have btime nor uid, mask %#x", s.mask)
+
+	var st syscall.Stat_t
+	s = statFromSyscall(&st)
+	for _, field := range []StatField{StatType, StatMode, StatNlink, StatUid, StatGid, StatAtime, StatMtime, StatCtime, StatIno, StatSize, StatBlocks} {
+		check(t, s.Has(field), "a struct stat should have field %#x", field)
+	}
+	check(t, !s.Has(StatBtime), "a struct stat should not have a btime")
+}
+
+func TestReaddirConcurrent(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	results := make([][]os.FileInfo, 2)
+	errs := make([]error, len(results))
+	var wg sync.WaitGroup
+	for i := range results {
+		d, err := vol.Open(tmpDir)
+		check(t, err == nil, "Open %q: %s", tmpDir, err)
+		defer d.Close()
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				infos, err := d.Readdir(1)
+				if err != nil || len(infos) == 0 {
+					errs[i] = err
+					return
+				}
+				results[i] = append(results[i], infos...)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := make(map[*syscall.Stat_t]bool)
+	for i, infos := range results {
+		check(t, errs[i] == nil, "Readdir %q: %s", tmpDir, errs[i])
+		check(t, len(infos) == 4, "incorrect number of entries %v", len(infos))
+
+		names := make(map[string]bool)
+		for _, info := range infos {
+			names[info.Name()] = true
+			st := info.Sys().(*syscall.Stat_t)
+			check(t, !stats[st], "the stat of %q aliases another entry", info.Name())
+			stats[st] = true
+		}
+		check(t, names["dir"] && names["file"], "incorrect entries %v", names)
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	path := "/TestReplaceAll"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(bytes.Repeat(data, 100))
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	for _, content := range [][]byte{[]byte("new contents"), {}} {
+		err = f.ReplaceAll(content)
+		check(t, err == nil, "ReplaceAll %q: %s", path, err)
+
+		got, err := f.ReadAllCapped(1 << 20)
+		check(t, err == nil && bytes.Equal(got, content), "ReplaceAll %q left %q, %s", path, got, err)
+	}
+}
+
+func TestErrno(t *testing.T) {
+	tests := []struct {
+		err   error
+		errno syscall.Errno
+	}{
+		{syscall.EIO, syscall.EIO},
+		{&os.PathError{Op: "read", Path: "/x", Err: syscall.EIO}, syscall.EIO},
+		{ErrIsDirectory, syscall.EISDIR},
+		{ErrNotDirectory, syscall.ENOTDIR},
+		{ErrReadOnly, syscall.EBADF},
+		{ErrNoAttr, errNoAttr},
+		{ErrNotSupported, syscall.ENOSYS},
+		{ErrSeekNotSupported, syscall.EOPNOTSUPP},
+		{fmt.Errorf("removexattr: %w", syscall.EPERM), syscall.EPERM},
+	}
+	for _, tt := range tests {
+		errno, ok := Errno(tt.err)
+		check(t, ok && errno == tt.errno, "Errno of %v: %v, %v, want %v", tt.err, errno, ok, tt.errno)
+	}
+
+	for _, err := range []error{nil, ErrClosed, io.EOF} {
+		_, ok := Errno(err)
+		check(t, !ok, "%v should carry no errno", err)
+	}
+
+	_, err := vol.Open("/TestErrno/missing")
+	errno, ok := Errno(err)
+	check(t, ok && errno == syscall.ENOENT && errors.Is(err, fs.ErrNotExist), "Errno of a failed Open: %v, %v, %v", errno, ok, err)
+}
+
+func TestSyncTimeout(t *testing.T) {
+	path := "/TestSyncTimeout"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	err = f.SyncTimeout(time.Minute)
+	check(t, err == nil, "SyncTimeout %q: %s", path, err)
+
+	err = f.SyncTimeout(0)
+	check(t, err == os.ErrDeadlineExceeded, "SyncTimeout without time should fail with ErrDeadlineExceeded, %v", err)
+
+	err = f.Close()
+	check(t, err == nil, "Close %q: %s", path, err)
+	err = f.SyncTimeout(time.Minute)
+	check(t, err == ErrClosed, "SyncTimeout on a closed fd should fail with ErrClosed, %v", err)
+}
+
+func TestReaddirFS(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer d.Close()
+
+	// "." and ".." don't count against n
+	entries, err := d.ReaddirFS(2)
+	check(t, err == nil, "ReaddirFS %q: %s", tmpDir, err)
+	check(t, len(entries) == 2, "incorrect number of entries %v", len(entries))
+
+	rest, err := d.ReaddirFS(2)
+	check(t, err == nil && len(rest) == 0, "ReaddirFS at the end %q: %v, %s", tmpDir, len(rest), err)
+
+	for _, e := range entries {
+		_, ok := e.(*DirEntry)
+		check(t, ok, "ReaddirFS should return DirEntry values, %T", e)
+
+		info, err := e.Info()
+		check(t, err == nil && info.Name() == e.Name(), "Info of %q: %v, %s", e.Name(), info, err)
+		check(t, info.Mode().Type() == e.Type(), "Type of %q %v differs from its Info %v", e.Name(), e.Type(), info.Mode())
+
+		switch e.Name() {
+		case "dir":
+			check(t, e.IsDir() && e.Type() == fs.ModeDir, "incorrect type of %q: %v", e.Name(), e.Type())
+		case "file":
+			check(t, !e.IsDir() && e.Type().IsRegular(), "incorrect type of %q: %v", e.Name(), e.Type())
+			check(t, info.Size() == int64(len(data)), "incorrect size of %q: %v", e.Name(), info.Size())
+		default:
+			t.Fatalf("unexpected entry %q", e.Name())
+		}
+	}
+}
+
 func TestUnmount(t *testing.T) {
 	err := vol.Unmount()
 	if err != nil {
@@ -420,3 +3245,70 @@ func check(t *testing.T, c bool, message string, args ...interface{}) {
 		t.Fatalf(message, args...)
 	}
 }
+
+// benchVolume mounts the test volume for a benchmark, as the tests unmount
+// the shared volume before benchmarks are run
+func benchVolume(b *testing.B) (*Volume, func()) {
+	v := new(Volume)
+	if err := v.Init("test", "localhost"); err != nil {
+		b.Fatalf("Failed to initialize volume. error: %v", err)
+	}
+	if err := v.Mount(); err != nil {
+		b.Fatalf("Failed to mount volume. error: %v", err)
+	}
+	return v, func() { v.Unmount() }
+}
+
+// benchFile creates a file of size bytes on v for a benchmark
+func benchFile(b *testing.B, v *Volume, path string, size int) (*File, func()) {
+	f, err := v.Create(path)
+	if err != nil {
+		b.Fatalf("Create %q: %s", path, err)
+	}
+	if _, err := f.Write(make([]byte, size)); err != nil {
+		b.Fatalf("Write %q: %s", path, err)
+	}
+	return f, func() {
+		f.Close()
+		v.Unlink(path)
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	v, unmount := benchVolume(b)
+	defer unmount()
+	f, clean := benchFile(b, v, "/BenchmarkRead", DefaultCopyBufferSize)
+	defer clean()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f.Seek(0, SeekStart)
+		buf := make([]byte, DefaultCopyBufferSize)
+		if _, err := f.Fd.Read(buf); err != nil {
+			b.Fatalf("Read: %s", err)
+		}
+	}
+}
+
+func BenchmarkPooledReader(b *testing.B) {
+	v, unmount := benchVolume(b)
+	defer unmount()
+	f, clean := benchFile(b, v, "/BenchmarkPooledReader", DefaultCopyBufferSize)
+	defer clean()
+
+	pool := &sync.Pool{New: func() interface{} {
+		buf := make([]byte, DefaultCopyBufferSize)
+		return &buf
+	}}
+	r := NewPooledReader(&f.Fd, pool)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f.Seek(0, SeekStart)
+		_, release, err := r.ReadChunk()
+		if err != nil {
+			b.Fatalf("ReadChunk: %s", err)
+		}
+		release()
+	}
+}
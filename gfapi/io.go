@@ -0,0 +1,323 @@
+package gfapi
+
+// This file includes helper types wrapping an Fd for use with the 'io' package
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// PooledReader reads chunks from an Fd into buffers drawn from a sync.Pool,
+// keeping allocations flat in servers reading many files.
+type PooledReader struct {
+	fd   *Fd
+	pool *sync.Pool
+}
+
+// NewPooledReader returns a PooledReader reading from fd into buffers drawn
+// from pool. The pool must hold *[]byte values, each chunk is read into the
+// full length of such a buffer. If the pool is empty and has no New function
+// a buffer of DefaultCopyBufferSize bytes is allocated.
+func NewPooledReader(fd *Fd, pool *sync.Pool) *PooledReader {
+	return &PooledReader{fd: fd, pool: pool}
+}
+
+// ReadChunk reads the next chunk from the current offset of the Fd.
+//
+// The returned slice is only valid until release is called, which gives the
+// buffer back to the pool. release must be called exactly once for each
+// successful ReadChunk; calling it again has no effect.
+//
+// Returns io.EOF at the end of the file
+func (r *PooledReader) ReadChunk() (chunk []byte, release func(), err error) {
+	bp, _ := r.pool.Get().(*[]byte)
+	if bp == nil {
+		buf := make([]byte, DefaultCopyBufferSize)
+		bp = &buf
+	}
+
+	n, err := r.fd.Read(*bp)
+	n, err = readEOF(*bp, n, err)
+	if err != nil {
+		r.pool.Put(bp)
+		return nil, func() {}, err
+	}
+
+	released := false
+	release = func() {
+		if !released {
+			released = true
+			r.pool.Put(bp)
+		}
+	}
+	return (*bp)[:n], release, nil
+}
+
+type teeReader struct {
+	src     *Fd
+	archive *Fd
+}
+
+// TeeReader returns an io.Reader which writes to archive everything it reads
+// from src, so the contents of src only need to be read once. A failed write
+// to archive is returned as an error of the Read which read the bytes.
+// io.EOF is returned at the end of src.
+func TeeReader(src *Fd, archive *Fd) io.Reader {
+	return &teeReader{src: src, archive: archive}
+}
+
+func (t *teeReader) Read(p []byte) (n int, err error) {
+	n, err = eofReader{t.src}.Read(p)
+	if n > 0 {
+		if _, werr := t.archive.Write(p[:n]); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// BufferedWriter buffers writes to an Fd, issuing them in chunks of the
+// buffer size. Like bufio.Writer, once a write to the Fd fails all further
+// calls return that error.
+//
+// Close must be called once done writing to flush the buffered bytes, its
+// error has to be checked since it may be the only report of a failed write.
+//
+// The written bytes aren't durable until they have been flushed, by Flush or
+// Close, and the Fd has then been synced, e.g. with SyncStat or Datasync.
+type BufferedWriter struct {
+	bw     *bufio.Writer
+	closed bool
+}
+
+// NewBufferedWriter returns a BufferedWriter writing to fd with a buffer of
+// DefaultCopyBufferSize bytes
+func NewBufferedWriter(fd *Fd) *BufferedWriter {
+	return newBufferedWriter(fd, DefaultCopyBufferSize)
+}
+
+// NewBufferedWriterSize returns a BufferedWriter writing to fd with a buffer
+// of size bytes, DefaultCopyBufferSize if size isn't positive. A larger buffer
+// means fewer and larger writes to the Fd for chatty writers.
+func NewBufferedWriterSize(fd *Fd, size int) *BufferedWriter {
+	if size <= 0 {
+		size = DefaultCopyBufferSize
+	}
+	return newBufferedWriter(fd, size)
+}
+
+func newBufferedWriter(w io.Writer, size int) *BufferedWriter {
+	return &BufferedWriter{bw: bufio.NewWriterSize(w, size)}
+}
+
+// Write writes the contents of p into the buffer, writing the buffer to the
+// Fd whenever it is full.
+//
+// Returns number of bytes written and an error if any
+func (b *BufferedWriter) Write(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrClosed
+	}
+	return b.bw.Write(p)
+}
+
+// Flush writes the buffered bytes to the Fd
+//
+// Returns error on failure, including an earlier failed write
+func (b *BufferedWriter) Flush() error {
+	if b.closed {
+		return ErrClosed
+	}
+	return b.bw.Flush()
+}
+
+// Close flushes the buffered bytes and closes the BufferedWriter. It doesn't
+// close the Fd.
+//
+// Returns error on failure, including any earlier failed write
+func (b *BufferedWriter) Close() error {
+	if b.closed {
+		return ErrClosed
+	}
+	b.closed = true
+	return b.bw.Flush()
+}
+
+// Counter wraps an Fd, counting the bytes read and written through it. The
+// counts can be read from another goroutine while transfers are running,
+// e.g. to report progress.
+type Counter struct {
+	fd      *Fd
+	read    atomic.Int64
+	written atomic.Int64
+}
+
+// NewCounter returns a Counter reading and writing through fd
+func NewCounter(fd *Fd) *Counter {
+	return &Counter{fd: fd}
+}
+
+// Read reads from the Fd like Fd.Read, counting the bytes read
+//
+// Returns number of bytes read and an error if any, io.EOF at the end of the file
+func (c *Counter) Read(p []byte) (int, error) {
+	n, err := eofReader{c.fd}.Read(p)
+	if n > 0 {
+		c.read.Add(int64(n))
+	}
+	return n, err
+}
+
+// Write writes to the Fd like Fd.Write, counting the bytes written
+//
+// Returns number of bytes written and an error if any
+func (c *Counter) Write(p []byte) (int, error) {
+	n, err := c.fd.Write(p)
+	if n > 0 {
+		c.written.Add(int64(n))
+	}
+	return n, err
+}
+
+// BytesRead returns the number of bytes read so far
+func (c *Counter) BytesRead() int64 {
+	return c.read.Load()
+}
+
+// BytesWritten returns the number of bytes written so far
+func (c *Counter) BytesWritten() int64 {
+	return c.written.Load()
+}
+
+// eofReader reads from an Fd like Fd.Read, but returns io.EOF at the end of
+// the file as io.Reader requires
+type eofReader struct {
+	fd *Fd
+}
+
+func (r eofReader) Read(p []byte) (int, error) {
+	n, err := r.fd.Read(p)
+	return readEOF(p, n, err)
+}
+
+// readEOF translates the result n, err of a read of p from an Fd into the one
+// io.Reader requires: the end of the file, reported as 0 bytes read and no
+// error, becomes io.EOF, and the -1 returned along with an error becomes 0
+func readEOF(p []byte, n int, err error) (int, error) {
+	if n < 0 {
+		n = 0
+	}
+	if n == 0 && len(p) > 0 && err == nil {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+// LineReader reads lines from an Fd, starting at its current offset, through
+// a buffer of the preferred I/O size of the file. Lines longer than the buffer
+// are returned whole.
+type LineReader struct {
+	br *bufio.Reader
+}
+
+// NewLineReader returns a LineReader reading from fd
+//
+// Returns error on failure
+func NewLineReader(fd *Fd) (*LineReader, error) {
+	var stat syscall.Stat_t
+	if err := fd.Fstat(&stat); err != nil {
+		return nil, err
+	}
+
+	size := int(stat.Blksize)
+	if size <= 0 {
+		size = DefaultCopyBufferSize
+	}
+	return &LineReader{br: bufio.NewReaderSize(eofReader{fd}, size)}, nil
+}
+
+// ReadString reads until the first occurrence of delim, like
+// bufio.Reader.ReadString.
+//
+// Returns the string including the delimiter. If the file ends before delim
+// the final partial string is returned along with io.EOF.
+func (r *LineReader) ReadString(delim byte) (string, error) {
+	return r.br.ReadString(delim)
+}
+
+// ReadLine reads the next line.
+//
+// Returns the line without its "\n" or "\r\n" terminator. If the file ends
+// without a terminator the final partial line is returned along with io.EOF,
+// and a nil line with io.EOF once all the lines have been read.
+func (r *LineReader) ReadLine() ([]byte, error) {
+	line, err := r.br.ReadBytes('\n')
+	if err == nil {
+		line = bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'})
+	}
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.EOF
+	}
+	return line, err
+}
+
+// PositionedReader reads an Fd with positional reads from its own offset,
+// leaving the offset of the Fd untouched. Many PositionedReaders can read the
+// same Fd concurrently, a single PositionedReader isn't safe for concurrent use.
+type PositionedReader struct {
+	fd  *Fd
+	off int64
+}
+
+// NewPositionedReader returns a PositionedReader reading fd from offset off
+func NewPositionedReader(fd *Fd, off int64) *PositionedReader {
+	return &PositionedReader{fd: fd, off: off}
+}
+
+// Read reads at most len(p) bytes from the offset of the reader and advances
+// it past them
+//
+// Returns number of bytes read and an error if any, io.EOF at the end of the file
+func (r *PositionedReader) Read(p []byte) (int, error) {
+	n, err := r.fd.Pread(p, r.off, nil)
+	n, err = readEOF(p, n, err)
+	if n > 0 {
+		r.off += int64(n)
+	}
+	return n, err
+}
+
+// Seek sets the offset of the reader based on whence, SeekStart - relative to
+// beginning of file, SeekCurrent - relative to current offset, SeekEnd -
+// relative to end
+//
+// Returns new offset and an error if any
+func (r *PositionedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case SeekStart:
+	case SeekCurrent:
+		offset += r.off
+	case SeekEnd:
+		size, err := r.fd.Size()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, syscall.EINVAL
+	}
+	if offset < 0 {
+		return 0, syscall.EINVAL
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// Offset returns the offset of the next Read
+func (r *PositionedReader) Offset() int64 {
+	return r.off
+}
@@ -0,0 +1,194 @@
+package gfapi
+
+// This file includes the IOQueue type, which limits the number of outstanding
+// asynchronous positional reads and writes on an Fd
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <errno.h>
+// #include <stdint.h>
+//
+// extern void gfapiIOComplete(uintptr_t handle, ssize_t ret, int errnum);
+//
+// static void gfapi_io_cbk(glfs_fd_t *fd, ssize_t ret, struct glfs_stat *prestat,
+//                          struct glfs_stat *poststat, void *data) {
+// 	gfapiIOComplete((uintptr_t)data, ret, ret < 0 ? errno : 0);
+// }
+//
+// static int gfapi_pread_async(glfs_fd_t *fd, void *buf, size_t count, off_t offset, uintptr_t handle) {
+// 	return glfs_pread_async(fd, buf, count, offset, 0, gfapi_io_cbk, (void *)handle);
+// }
+//
+// static int gfapi_pwrite_async(glfs_fd_t *fd, void *buf, size_t count, off_t offset, uintptr_t handle) {
+// 	return glfs_pwrite_async(fd, buf, count, offset, 0, gfapi_io_cbk, (void *)handle);
+// }
+import "C"
+import (
+	"errors"
+	"runtime"
+	"runtime/cgo"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// IOResult is the completion of an operation submitted to an IOQueue
+type IOResult struct {
+	// Write is true for writes and false for reads
+	Write bool
+	// Buf is the buffer which was passed to Submit
+	Buf []byte
+	// Off is the offset which was passed to Submit
+	Off int64
+	// N is the number of bytes read or written
+	N int
+	// Err is the error of the operation, if any
+	Err error
+}
+
+// IOQueue submits asynchronous positional reads and writes on an Fd, while
+// limiting the number of outstanding operations to a maximum depth.
+//
+// A buffer passed to SubmitRead or SubmitWrite must not be touched until its
+// IOResult has been received from Completions.
+type IOQueue struct {
+	fd      *Fd
+	slots   chan struct{}
+	results chan IOResult
+	done    chan IOResult
+	wg      sync.WaitGroup
+}
+
+type ioRequest struct {
+	q      *IOQueue
+	result IOResult
+	pinner runtime.Pinner
+}
+
+// ErrIOQueueDepth is returned by NewIOQueue when the requested depth is not positive
+var ErrIOQueueDepth = errors.New("queue depth must be positive")
+
+// NewIOQueue creates an IOQueue on fd, allowing at most depth operations to
+// be outstanding at the same time. An operation stays outstanding until its
+// IOResult has been received from Completions.
+func NewIOQueue(fd *Fd, depth int) (*IOQueue, error) {
+	if depth <= 0 {
+		return nil, ErrIOQueueDepth
+	}
+
+	q := &IOQueue{
+		fd:      fd,
+		slots:   make(chan struct{}, depth),
+		results: make(chan IOResult, depth),
+		done:    make(chan IOResult),
+	}
+	go q.forward()
+
+	return q, nil
+}
+
+// Completions returns the channel on which the results of the submitted
+// operations are delivered. The channel is closed by Close.
+func (q *IOQueue) Completions() <-chan IOResult {
+	return q.done
+}
+
+// SubmitRead submits an asynchronous read of len(b) bytes into b from offset
+// off. SubmitRead blocks while the maximum depth of the queue is reached.
+//
+// Returns an error if the read could not be submitted, in which case no
+// IOResult is delivered for it.
+func (q *IOQueue) SubmitRead(b []byte, off int64) error {
+	return q.submit(false, b, off)
+}
+
+// SubmitWrite submits an asynchronous write of len(b) bytes from b at offset
+// off. SubmitWrite blocks while the maximum depth of the queue is reached.
+//
+// Returns an error if the write could not be submitted, in which case no
+// IOResult is delivered for it. Like Pwrite it is refused on a directory or a
+// read-only Fd, and when unaligned on an Fd opened with O_DIRECT.
+func (q *IOQueue) SubmitWrite(b []byte, off int64) error {
+	return q.submit(true, b, off)
+}
+
+// Close waits for all submitted operations to complete and closes the
+// Completions channel. Results must keep being received from Completions
+// while Close is waiting. No operation may be submitted after Close.
+func (q *IOQueue) Close() {
+	q.wg.Wait()
+	close(q.results)
+}
+
+func (q *IOQueue) submit(write bool, b []byte, off int64) error {
+	if q.fd.fd == nil {
+		return ErrClosed
+	}
+	if write {
+		if err := q.fd.checkWritable(); err != nil {
+			return err
+		}
+	}
+	if err := q.fd.checkDirectIO(off, len(b)); err != nil {
+		return err
+	}
+
+	q.slots <- struct{}{}
+	q.wg.Add(1)
+
+	result := IOResult{Write: write, Buf: b, Off: off}
+	if len(b) == 0 {
+		q.results <- result
+		q.wg.Done()
+		return nil
+	}
+
+	req := &ioRequest{q: q, result: result}
+	req.pinner.Pin(&b[0])
+	h := cgo.NewHandle(req)
+
+	var ret C.int
+	var err error
+	if write {
+		ret, err = C.gfapi_pwrite_async(q.fd.fd, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.off_t(off), C.uintptr_t(h))
+	} else {
+		ret, err = C.gfapi_pread_async(q.fd.fd, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.off_t(off), C.uintptr_t(h))
+	}
+
+	if ret < 0 {
+		h.Delete()
+		req.pinner.Unpin()
+		q.wg.Done()
+		<-q.slots
+		return err
+	}
+
+	return nil
+}
+
+// forward hands the results over to the consumer, freeing a slot only once a
+// result has been received so that undrained results count against the depth
+func (q *IOQueue) forward() {
+	for r := range q.results {
+		q.done <- r
+		<-q.slots
+	}
+	close(q.done)
+}
+
+// complete is called from the gluster callback once an operation finished
+func (req *ioRequest) complete(ret int, errnum int) {
+	req.pinner.Unpin()
+	if req.result.Write {
+		req.q.fd.statChanged()
+	}
+
+	req.result.N = ret
+	if ret < 0 {
+		req.result.N = 0
+		req.result.Err = syscall.Errno(errnum)
+	}
+
+	req.q.results <- req.result
+	req.q.wg.Done()
+}
@@ -0,0 +1,21 @@
+package gfapi
+
+// This file includes the callback exported to C for the asynchronous
+// operations of IOQueue. It is kept apart since a file with exports may only
+// have declarations in its preamble.
+
+// #include <stdint.h>
+// #include <sys/types.h>
+import "C"
+import (
+	"runtime/cgo"
+)
+
+//export gfapiIOComplete
+func gfapiIOComplete(handle C.uintptr_t, ret C.ssize_t, errnum C.int) {
+	h := cgo.Handle(handle)
+	req := h.Value().(*ioRequest)
+	h.Delete()
+
+	req.complete(int(ret), int(errnum))
+}
@@ -0,0 +1,229 @@
+package gfapi
+
+// This file includes the vectored I/O operations on fd
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <stdlib.h>
+// #include <sys/uio.h>
+import "C"
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// maxIovecs is the maximum number of buffers passed to a single vectored call,
+// the same as IOV_MAX on Linux
+const maxIovecs = 1024
+
+// iovecs is a C allocated iovec array pointing into pinned Go buffers
+type iovecs struct {
+	iov    *C.struct_iovec
+	cnt    int
+	pinner runtime.Pinner
+}
+
+// newIovecs returns the iovecs for at most maxIovecs of the non-empty bufs.
+// free must be called once the vectored call returned.
+func newIovecs(bufs [][]byte) *iovecs {
+	v := &iovecs{}
+
+	var cnt int
+	for _, b := range bufs {
+		if len(b) > 0 && cnt < maxIovecs {
+			cnt++
+		}
+	}
+	if cnt == 0 {
+		return v
+	}
+
+	v.iov = (*C.struct_iovec)(C.calloc(C.size_t(cnt), C.size_t(unsafe.Sizeof(C.struct_iovec{}))))
+	iov := unsafe.Slice(v.iov, cnt)
+	for _, b := range bufs {
+		if len(b) == 0 {
+			continue
+		}
+		if v.cnt == cnt {
+			break
+		}
+		v.pinner.Pin(&b[0])
+		iov[v.cnt].iov_base = unsafe.Pointer(&b[0])
+		iov[v.cnt].iov_len = C.size_t(len(b))
+		v.cnt++
+	}
+
+	return v
+}
+
+func (v *iovecs) free() {
+	v.pinner.Unpin()
+	if v.iov != nil {
+		C.free(unsafe.Pointer(v.iov))
+	}
+}
+
+// consumeBuffers advances bufs past the first n bytes, like net.Buffers does
+// when it is written
+func consumeBuffers(bufs *net.Buffers, n int64) {
+	for len(*bufs) > 0 {
+		ln0 := int64(len((*bufs)[0]))
+		if ln0 > n {
+			(*bufs)[0] = (*bufs)[0][n:]
+			return
+		}
+		n -= ln0
+		(*bufs)[0] = nil
+		*bufs = (*bufs)[1:]
+	}
+}
+
+func buffersLen(bufs net.Buffers) (n int64) {
+	for _, b := range bufs {
+		n += int64(len(b))
+	}
+	return n
+}
+
+// writev performs a single glfs_writev of bufs on the Fd, retrying when
+// interrupted
+func (fd *Fd) writev(bufs [][]byte) (int64, error) {
+	v := newIovecs(bufs)
+	defer v.free()
+
+	if v.cnt == 0 {
+		return 0, nil
+	}
+
+	ret, err := ignoringEINTR(func() (int, error) {
+		ret, err := C.glfs_writev(fd.fd, v.iov, C.int(v.cnt), 0)
+		fd.statChanged()
+		return int(ret), err
+	})
+	if ret < 0 {
+		return 0, err
+	}
+	return int64(ret), nil
+}
+
+// WriteBuffers writes the contents of bufs into the Fd using vectored writes.
+// Like Write it keeps writing until all of bufs has been written or an error
+// occurs, and it is refused the same way on a directory or a read-only Fd.
+// bufs is advanced past the written bytes, the same way writing a net.Buffers
+// consumes it. Empty bufs write nothing, without calling libgfapi.
+//
+// The write deadline applies as it does to Write. With a deadline set the
+// buffers are joined and written with Write, as a call abandoned on the
+// deadline must not keep using them.
+//
+// Returns number of bytes written on success and error on failure
+func (fd *Fd) WriteBuffers(bufs *net.Buffers) (n int64, err error) {
+	if fd.fd == nil {
+		return 0, ErrClosed
+	}
+	if err := fd.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	total := buffersLen(*bufs)
+	if total == 0 {
+		return 0, nil
+	}
+
+	if deadline := fd.writeDeadline.Load(); deadline != 0 {
+		m, err := fd.Write(bytes.Join(*bufs, nil))
+		consumeBuffers(bufs, int64(m))
+		return int64(m), err
+	}
+
+	if obs := loadMetricsObserver(); obs != nil {
+		defer func(start time.Time) {
+			n := int(n)
+			observe(obs, "writev", start, &n, &err)
+		}(time.Now())
+	}
+	if l := loadLogger(); l != nil {
+		defer func() {
+			n := int(n)
+			logOp(l, "writev", &n, &err, "len", total)
+		}()
+	}
+
+	for buffersLen(*bufs) > 0 {
+		m, err := fd.writev(*bufs)
+		consumeBuffers(bufs, m)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+
+	return n, nil
+}
+
+// AppendFrame writes header followed by payload at the end of the file with a
+// vectored write, so the frame takes a single call in the common case. Like
+// Append it holds the Fd lock, so frames of concurrent callers using Append
+// or AppendFrame on the same Fd are not interleaved.
+//
+// Returns number of bytes written, which is len(header)+len(payload) on
+// success, and error on failure
+func (fd *Fd) AppendFrame(header, payload []byte) (int, error) {
+	if fd.fd == nil {
+		return 0, ErrClosed
+	}
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	if fd.flags&os.O_APPEND == 0 {
+		if _, err := fd.Seek(0, SeekEnd); err != nil {
+			return 0, err
+		}
+	}
+
+	bufs := net.Buffers{header, payload}
+	n, err := fd.WriteBuffers(&bufs)
+	return int(n), err
+}
+
+// ReadBuffers reads from the Fd into bufs with a single vectored read,
+// filling the buffers in order. bufs is advanced past the filled bytes.
+// Empty bufs read nothing, without calling libgfapi.
+//
+// Returns number of bytes read on success and error on failure. io.EOF is
+// returned when no bytes could be read at the end of the file.
+func (fd *Fd) ReadBuffers(bufs *net.Buffers) (int64, error) {
+	if fd.fd == nil {
+		return 0, ErrClosed
+	}
+
+	if buffersLen(*bufs) == 0 {
+		return 0, nil
+	}
+
+	v := newIovecs(*bufs)
+	defer v.free()
+
+	ret, err := ignoringEINTR(func() (int, error) {
+		ret, err := C.glfs_readv(fd.fd, v.iov, C.int(v.cnt), 0)
+		return int(ret), err
+	})
+	if ret < 0 {
+		return 0, err
+	}
+	if ret == 0 {
+		return 0, io.EOF
+	}
+
+	consumeBuffers(bufs, int64(ret))
+	return int64(ret), nil
+}
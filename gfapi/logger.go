@@ -0,0 +1,56 @@
+package gfapi
+
+// This file includes the optional debug logger invoked around fd operations
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Logger receives the debug lines of the package
+//
+// Logf may be called concurrently from multiple goroutines.
+type Logger interface {
+	Logf(format string, args ...any)
+}
+
+var logger atomic.Pointer[Logger]
+
+// SetLogger sets the logger which receives a line for every Read, Write,
+// Pread, Pwrite, Fsync and Readdir with its arguments, result and error.
+// Passing nil removes the logger, after which nothing is formatted at all.
+//
+// The lines have the form "gfapi: op=pread len=4096 off=0 n=4096 err=<nil>".
+func SetLogger(l Logger) {
+	if l == nil {
+		logger.Store(nil)
+		return
+	}
+	logger.Store(&l)
+}
+
+// loadLogger returns the current logger or nil if none is set
+func loadLogger() Logger {
+	if l := logger.Load(); l != nil {
+		return *l
+	}
+	return nil
+}
+
+// logOp logs an operation to l. It is meant to be deferred, with n and err
+// pointing to the results of the operation. n may be nil for operations which
+// don't transfer data. args are alternating names and values of the
+// arguments of the operation.
+func logOp(l Logger, op string, n *int, err *error, args ...any) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "gfapi: op=%s", op)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	if n != nil {
+		fmt.Fprintf(&b, " n=%d", *n)
+	}
+	fmt.Fprintf(&b, " err=%v", *err)
+	l.Logf("%s", b.String())
+}
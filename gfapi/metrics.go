@@ -0,0 +1,50 @@
+package gfapi
+
+// This file includes the optional metrics hook invoked around fd operations
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MetricsObserver is called after an observed operation completes.
+//
+// op identifies the operation ("read", "write", "pread", "pwrite", "fsync" or
+// "readdir"), bytes is the number of bytes transferred (0 for operations which
+// don't transfer data), dur is the wall-clock duration of the operation and
+// err is the error returned by it, if any.
+type MetricsObserver func(op string, bytes int, dur time.Duration, err error)
+
+var metricsObserver atomic.Pointer[MetricsObserver]
+
+// SetMetricsObserver sets the observer called around Read, Write, Pread,
+// Pwrite, Fsync and Readdir. Passing nil removes the observer, after which
+// no timing is done at all.
+//
+// The observer may be called concurrently from multiple goroutines.
+func SetMetricsObserver(obs MetricsObserver) {
+	if obs == nil {
+		metricsObserver.Store(nil)
+		return
+	}
+	metricsObserver.Store(&obs)
+}
+
+// loadMetricsObserver returns the current observer or nil if none is set
+func loadMetricsObserver() MetricsObserver {
+	if obs := metricsObserver.Load(); obs != nil {
+		return *obs
+	}
+	return nil
+}
+
+// observe reports an operation which started at start to obs. It is meant to
+// be deferred, with n and err pointing to the results of the operation. n may
+// be nil for operations which don't transfer data.
+func observe(obs MetricsObserver, op string, start time.Time, n *int, err *error) {
+	var bytes int
+	if n != nil && *n > 0 {
+		bytes = *n
+	}
+	obs(op, bytes, time.Since(start), *err)
+}
@@ -0,0 +1,120 @@
+package gfapi
+
+// This file includes readers and writers limiting the bandwidth of the I/O on
+// an Fd
+
+import (
+	"sync"
+	"syscall"
+	"time"
+)
+
+// tokenBucket allows rate bytes per second, with bursts of at most burst
+// bytes. It is safe for concurrent use.
+type tokenBucket struct {
+	rate  int64
+	burst int64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// wait takes n tokens from the bucket, sleeping until the bucket has refilled
+// enough when there aren't that many. n must not exceed the burst.
+func (b *tokenBucket) wait(n int) {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / float64(b.rate) * float64(time.Second)))
+	}
+}
+
+// RateLimitedReader reads from the current offset of an Fd at no more than a
+// given number of bytes per second, e.g. to keep a backup from saturating the
+// link of the client. Bursts of up to one second worth of bytes are allowed.
+type RateLimitedReader struct {
+	fd     *Fd
+	bucket *tokenBucket
+}
+
+// NewRateLimitedReader returns a RateLimitedReader reading fd at no more than
+// bytesPerSec bytes per second
+//
+// Returns error if bytesPerSec isn't positive
+func NewRateLimitedReader(fd *Fd, bytesPerSec int64) (*RateLimitedReader, error) {
+	if bytesPerSec <= 0 {
+		return nil, syscall.EINVAL
+	}
+	return &RateLimitedReader{fd: fd, bucket: newTokenBucket(bytesPerSec)}, nil
+}
+
+// Read reads at most len(p) bytes from the Fd, and then waits as long as
+// needed to stay under the rate. A single Read reads at most one second worth
+// of bytes.
+//
+// Returns number of bytes read and an error if any, io.EOF at the end of the file
+func (r *RateLimitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.bucket.burst {
+		p = p[:r.bucket.burst]
+	}
+
+	n, err := eofReader{r.fd}.Read(p)
+	if n > 0 {
+		r.bucket.wait(n)
+	}
+	return n, err
+}
+
+// RateLimitedWriter writes to the current offset of an Fd at no more than a
+// given number of bytes per second. Bursts of up to one second worth of bytes
+// are allowed.
+type RateLimitedWriter struct {
+	fd     *Fd
+	bucket *tokenBucket
+}
+
+// NewRateLimitedWriter returns a RateLimitedWriter writing to fd at no more
+// than bytesPerSec bytes per second
+//
+// Returns error if bytesPerSec isn't positive
+func NewRateLimitedWriter(fd *Fd, bytesPerSec int64) (*RateLimitedWriter, error) {
+	if bytesPerSec <= 0 {
+		return nil, syscall.EINVAL
+	}
+	return &RateLimitedWriter{fd: fd, bucket: newTokenBucket(bytesPerSec)}, nil
+}
+
+// Write writes all of p to the Fd, in chunks of at most one second worth of
+// bytes, waiting before each chunk as long as needed to stay under the rate.
+//
+// Returns number of bytes written and an error if any
+func (w *RateLimitedWriter) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		chunk := p[n:]
+		if int64(len(chunk)) > w.bucket.burst {
+			chunk = chunk[:w.bucket.burst]
+		}
+
+		w.bucket.wait(len(chunk))
+		m, err := w.fd.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
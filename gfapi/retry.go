@@ -0,0 +1,144 @@
+package gfapi
+
+// This file includes the copy of an Fd retrying the transient errors
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// defaultRetryableErrnos are the errnos retried unless changed with
+// SetRetryableErrnos: EAGAIN, and ENOTCONN which is returned while the client
+// reconnects to a brick
+var defaultRetryableErrnos = []syscall.Errno{syscall.EAGAIN, syscall.ENOTCONN}
+
+var retryableErrnos atomic.Pointer[[]syscall.Errno]
+
+// retryBackoff is the pause before the first retry, doubled at each
+// following retry of the same read up to maxRetryBackoff
+var retryBackoff = 100 * time.Millisecond
+
+// maxRetryBackoff caps the pause between two retries
+const maxRetryBackoff = 10 * time.Second
+
+// SetRetryableErrnos sets the errnos retried by CopyToWithRetry. Passing no
+// errno restores DefaultRetryableErrnos.
+func SetRetryableErrnos(errnos ...syscall.Errno) {
+	if len(errnos) == 0 {
+		retryableErrnos.Store(nil)
+		return
+	}
+	errnos = slices.Clone(errnos)
+	retryableErrnos.Store(&errnos)
+}
+
+// RetryableErrnos returns the errnos retried by CopyToWithRetry
+func RetryableErrnos() []syscall.Errno {
+	if errnos := retryableErrnos.Load(); errnos != nil {
+		return slices.Clone(*errnos)
+	}
+	return DefaultRetryableErrnos()
+}
+
+// DefaultRetryableErrnos returns the errnos retried by CopyToWithRetry unless
+// changed with SetRetryableErrnos: EAGAIN, and ENOTCONN which is returned
+// while the client reconnects to a brick
+func DefaultRetryableErrnos() []syscall.Errno {
+	return slices.Clone(defaultRetryableErrnos)
+}
+
+// isRetryable reports whether err is one of the retryable errnos
+func isRetryable(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+
+	errnos := defaultRetryableErrnos
+	if p := retryableErrnos.Load(); p != nil {
+		errnos = *p
+	}
+	return slices.Contains(errnos, errno)
+}
+
+// CopyToWithRetry writes the contents of the Fd from its current offset to w,
+// like io.Copy, surviving transient gluster errors. When a read fails with one
+// of the RetryableErrnos it is retried from the last offset copied, after a
+// growing pause, at most retries times in a row. Any other error, or a write
+// error, is returned immediately.
+//
+// The reads are positional, the offset of the Fd is set past the copied bytes
+// once done.
+//
+// Returns number of bytes written and error on failure, the last error when
+// the retries are exhausted
+func (fd *Fd) CopyToWithRetry(w io.Writer, retries int) (int64, error) {
+	if retries < 0 {
+		return 0, syscall.EINVAL
+	}
+
+	off, err := fd.Offset()
+	if err != nil {
+		return 0, err
+	}
+	size, err := fd.copyBufferSize()
+	if err != nil {
+		return 0, err
+	}
+
+	readAt := func(b []byte, off int64) (int, error) {
+		return fd.Pread(b, off, nil)
+	}
+	written, err := copyWithRetry(w, readAt, off, make([]byte, size), retries)
+	if _, serr := fd.Seek(off+written, SeekStart); err == nil {
+		err = serr
+	}
+	return written, err
+}
+
+// copyWithRetry writes the bytes read with readAt from off to w through buf,
+// retrying each read failing with a retryable error at most retries times
+func copyWithRetry(w io.Writer, readAt func([]byte, int64) (int, error), off int64, buf []byte, retries int) (written int64, err error) {
+	failures := 0
+	for {
+		n, rerr := readAt(buf, off+written)
+		if rerr != nil {
+			if !isRetryable(rerr) || failures >= retries {
+				return written, rerr
+			}
+			if retryBackoff > 0 {
+				time.Sleep(retryDelay(failures))
+			}
+			failures++
+			continue
+		}
+		failures = 0
+		if n == 0 {
+			return written, nil
+		}
+
+		wn, werr := w.Write(buf[:n])
+		written += int64(wn)
+		if werr != nil {
+			return written, werr
+		}
+		if wn != n {
+			return written, io.ErrShortWrite
+		}
+	}
+}
+
+// retryDelay returns the pause before the retry following the given number of
+// failures in a row, doubled at each failure without overflowing past
+// maxRetryBackoff
+func retryDelay(failures int) time.Duration {
+	d := retryBackoff
+	for i := 0; i < failures && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryBackoff)
+}
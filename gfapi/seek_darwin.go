@@ -0,0 +1,8 @@
+package gfapi
+
+// SeekData and SeekHole are the whence values used to seek to the next region
+// containing data and the next hole in a sparse file
+const (
+	SeekData = 4
+	SeekHole = 3
+)
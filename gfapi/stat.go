@@ -0,0 +1,363 @@
+package gfapi
+
+// This file includes helpers to build a Stat and accessors for its fields
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Bits of the glfs_stat mask telling which fields are set, the same as the
+// GLFS_STAT_* values of glfs.h
+const (
+	statMode       = 0x2
+	statUid        = 0x8
+	statGid        = 0x10
+	statAtime      = 0x20
+	statMtime      = 0x40
+	statSize       = 0x200
+	statBasicStats = 0x7ff
+	statBtime      = 0x800
+)
+
+// StatField is a field of a Stat, as a bit of its mask
+type StatField uint64
+
+// StatType .. StatBtime are the fields of a Stat which Has can check. The
+// server may leave some of them out, e.g. the btime is only reported by the
+// operations returning a glfs_stat and when the bricks support it.
+const (
+	StatType   StatField = 0x1
+	StatMode   StatField = statMode
+	StatNlink  StatField = 0x4
+	StatUid    StatField = statUid
+	StatGid    StatField = statGid
+	StatAtime  StatField = statAtime
+	StatMtime  StatField = statMtime
+	StatCtime  StatField = 0x80
+	StatIno    StatField = 0x100
+	StatSize   StatField = statSize
+	StatBlocks StatField = 0x400
+	StatBtime  StatField = statBtime
+)
+
+// Has reports whether field was populated in the Stat, to tell a zero value
+// actually reported, like an mtime at the epoch, from a field the server
+// didn't report
+func (s *Stat) Has(field StatField) bool {
+	return s.mask&uint64(field) == uint64(field)
+}
+
+// ModeToGlfs returns the raw posix mode, as used by Fchmod and stored in a
+// Stat, of the Go mode m including its file type bits
+func ModeToGlfs(m os.FileMode) uint32 {
+	o := posixMode(m)
+	switch m & os.ModeType {
+	case 0:
+		o |= syscall.S_IFREG
+	case os.ModeDir:
+		o |= syscall.S_IFDIR
+	case os.ModeSymlink:
+		o |= syscall.S_IFLNK
+	case os.ModeNamedPipe:
+		o |= syscall.S_IFIFO
+	case os.ModeSocket:
+		o |= syscall.S_IFSOCK
+	case os.ModeDevice:
+		o |= syscall.S_IFBLK
+	case os.ModeDevice | os.ModeCharDevice:
+		o |= syscall.S_IFCHR
+	}
+	return o
+}
+
+// GlfsToMode returns the Go mode of the raw posix mode m, including its file
+// type, setuid, setgid and sticky bits
+func GlfsToMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	switch m & syscall.S_IFMT {
+	case syscall.S_IFBLK:
+		mode |= os.ModeDevice
+	case syscall.S_IFCHR:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case syscall.S_IFDIR:
+		mode |= os.ModeDir
+	case syscall.S_IFIFO:
+		mode |= os.ModeNamedPipe
+	case syscall.S_IFLNK:
+		mode |= os.ModeSymlink
+	case syscall.S_IFREG:
+		// nothing to do
+	case syscall.S_IFSOCK:
+		mode |= os.ModeSocket
+	}
+	if m&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// StatOption sets a field of a Stat built with NewStat
+type StatOption func(*Stat)
+
+// NewStat returns a Stat with the fields set by opts, to be passed to
+// operations taking a Stat as input. The fields which aren't set are zero and
+// left out of the mask of the Stat, so they are ignored by such operations.
+func NewStat(opts ...StatOption) *Stat {
+	s := &Stat{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithMode sets the permission, setuid, setgid and sticky bits of the mode
+func WithMode(mode os.FileMode) StatOption {
+	return func(s *Stat) {
+		s.mode = posixMode(mode)
+		s.mask |= statMode
+	}
+}
+
+// WithUid sets the user ID of the owner
+func WithUid(uid uint32) StatOption {
+	return func(s *Stat) {
+		s.uid = uid
+		s.mask |= statUid
+	}
+}
+
+// WithGid sets the group ID of the owner
+func WithGid(gid uint32) StatOption {
+	return func(s *Stat) {
+		s.gid = gid
+		s.mask |= statGid
+	}
+}
+
+// WithAtime sets the last access time
+func WithAtime(atime time.Time) StatOption {
+	return func(s *Stat) {
+		s.atime = atime
+		s.mask |= statAtime
+	}
+}
+
+// WithMtime sets the last data modification time
+func WithMtime(mtime time.Time) StatOption {
+	return func(s *Stat) {
+		s.mtime = mtime
+		s.mask |= statMtime
+	}
+}
+
+// WithSize sets the size of the file
+func WithSize(size int64) StatOption {
+	return func(s *Stat) {
+		s.size = size
+		s.mask |= statSize
+	}
+}
+
+// statFromSyscall returns a Stat populated from the given syscall.Stat_t.
+// A struct stat carries no creation time, so btime is left unset and out of
+// the mask.
+func statFromSyscall(st *syscall.Stat_t) *Stat {
+	s := &Stat{
+		mask:     statBasicStats,
+		atime:    utcTime(getLastAccess(st)),
+		ctime:    utcTime(getLastChange(st)),
+		mtime:    utcTime(getLastModification(st)),
+		ino:      uint64(st.Ino),
+		size:     int64(st.Size),
+		blocks:   uint64(st.Blocks),
+		blkksize: int64(st.Blksize),
+		nlink:    uint64(st.Nlink),
+		uid:      uint32(st.Uid),
+		gid:      uint32(st.Gid),
+		mode:     uint32(st.Mode),
+	}
+	s.devMajor, s.devMinor = splitDev(uint64(st.Dev))
+	s.rdevMajor, s.rdevMinor = splitDev(uint64(st.Rdev))
+
+	return s
+}
+
+// utcTime returns the time of ts in UTC, and the zero time for a zero ts, so
+// the times of a Stat are the same whether it comes from a struct stat or from
+// a glfs_stat converted by FromGlfsStat
+func utcTime(ts syscall.Timespec) time.Time {
+	if ts.Sec == 0 && ts.Nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(ts.Sec), int64(ts.Nsec)).UTC()
+}
+
+// Mode returns the mode of the file as an os.FileMode
+func (s *Stat) Mode() os.FileMode {
+	return GlfsToMode(s.mode)
+}
+
+// IsDir reports whether the file is a directory
+func (s *Stat) IsDir() bool {
+	return s.mode&syscall.S_IFMT == syscall.S_IFDIR
+}
+
+// IsRegular reports whether the file is a regular file
+func (s *Stat) IsRegular() bool {
+	return s.mode&syscall.S_IFMT == syscall.S_IFREG
+}
+
+// IsSymlink reports whether the file is a symbolic link
+func (s *Stat) IsSymlink() bool {
+	return s.mode&syscall.S_IFMT == syscall.S_IFLNK
+}
+
+// IsDevice reports whether the file is a block or character device
+func (s *Stat) IsDevice() bool {
+	typ := s.mode & syscall.S_IFMT
+	return typ == syscall.S_IFBLK || typ == syscall.S_IFCHR
+}
+
+// IsNamedPipe reports whether the file is a named pipe
+func (s *Stat) IsNamedPipe() bool {
+	return s.mode&syscall.S_IFMT == syscall.S_IFIFO
+}
+
+// Size returns the size of the file in bytes
+func (s *Stat) Size() int64 {
+	return s.size
+}
+
+// Blocks returns the number of 512-byte blocks allocated to the file.
+// Blocks()*512 may be smaller than Size() for sparse files.
+func (s *Stat) Blocks() uint64 {
+	return s.blocks
+}
+
+// PreferredIOSize returns the preferred block size for efficient I/O on the file
+func (s *Stat) PreferredIOSize() int64 {
+	return s.blkksize
+}
+
+// Rdev returns the major and minor numbers of the device, if the file is a
+// block or character device
+func (s *Stat) Rdev() (major uint32, minor uint32) {
+	return s.rdevMajor, s.rdevMinor
+}
+
+// Dev returns the major and minor numbers of the device containing the file
+func (s *Stat) Dev() (major uint32, minor uint32) {
+	return s.devMajor, s.devMinor
+}
+
+// Nlink returns the number of hard links to the file
+func (s *Stat) Nlink() uint64 {
+	return s.nlink
+}
+
+// IsHardLinked reports whether the file has more than one hard link. It is
+// always false for directories, whose link count includes their
+// subdirectories.
+func (s *Stat) IsHardLinked() bool {
+	return s.nlink > 1 && !s.IsDir()
+}
+
+// Key returns a string identifying the inode of the file, made of the device
+// containing it and its inode number. Hard links of a file have the same Key,
+// so it can be used as a map key to detect the inodes already seen.
+func (s *Stat) Key() string {
+	return fmt.Sprintf("%d:%d:%d", s.devMajor, s.devMinor, s.ino)
+}
+
+// SameContents reports whether s and other describe a file with the same
+// contents, judged by their size and modification time. Two nil Stats are
+// the same, a nil and a non-nil Stat are not.
+func (s *Stat) SameContents(other *Stat) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	return s.size == other.size && s.mtime.Equal(other.mtime)
+}
+
+// Changed reports whether the file described by other has changed compared
+// to s, judged by their size, modification time, status change time and
+// inode number. A nil and a non-nil Stat are always changed.
+func (s *Stat) Changed(other *Stat) bool {
+	if s == nil || other == nil {
+		return s != other
+	}
+	return !s.SameContents(other) || !s.ctime.Equal(other.ctime) || s.ino != other.ino
+}
+
+// String returns a one line description of the Stat in the style of ls -l:
+// the type and permissions, number of links, uid, gid, size and modification
+// time
+func (s *Stat) String() string {
+	if s == nil {
+		return "<nil>"
+	}
+
+	mtime := "-"
+	if !s.mtime.IsZero() {
+		mtime = s.mtime.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf("%s %d %d %d %d %s", s.modeString(), s.nlink, s.uid, s.gid, s.size, mtime)
+}
+
+// modeString formats the mode like ls -l, e.g. "drwxr-xr-x"
+func (s *Stat) modeString() string {
+	var b [10]byte
+
+	switch s.mode & syscall.S_IFMT {
+	case syscall.S_IFREG:
+		b[0] = '-'
+	case syscall.S_IFDIR:
+		b[0] = 'd'
+	case syscall.S_IFLNK:
+		b[0] = 'l'
+	case syscall.S_IFBLK:
+		b[0] = 'b'
+	case syscall.S_IFCHR:
+		b[0] = 'c'
+	case syscall.S_IFIFO:
+		b[0] = 'p'
+	case syscall.S_IFSOCK:
+		b[0] = 's'
+	default:
+		b[0] = '?'
+	}
+
+	const rwx = "rwxrwxrwx"
+	for i := 0; i < 9; i++ {
+		if s.mode&(1<<uint(8-i)) != 0 {
+			b[i+1] = rwx[i]
+		} else {
+			b[i+1] = '-'
+		}
+	}
+
+	special := func(i int, bit uint32, set, unset byte) {
+		if s.mode&bit == 0 {
+			return
+		}
+		if b[i] == 'x' {
+			b[i] = set
+		} else {
+			b[i] = unset
+		}
+	}
+	special(3, syscall.S_ISUID, 's', 'S')
+	special(6, syscall.S_ISGID, 's', 'S')
+	special(9, syscall.S_ISVTX, 't', 'T')
+
+	return string(b[:])
+}
@@ -8,3 +8,20 @@ import (
 func getLastModification(st *syscall.Stat_t) syscall.Timespec {
 	return st.Mtimespec
 }
+
+// getLastAccess returns the access time
+func getLastAccess(st *syscall.Stat_t) syscall.Timespec {
+	return st.Atimespec
+}
+
+// getLastChange returns the status change time
+func getLastChange(st *syscall.Stat_t) syscall.Timespec {
+	return st.Ctimespec
+}
+
+// splitDev returns the major and minor numbers of the device number dev
+func splitDev(dev uint64) (major uint32, minor uint32) {
+	major = uint32((dev >> 24) & 0xff)
+	minor = uint32(dev & 0xffffff)
+	return major, minor
+}
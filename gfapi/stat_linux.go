@@ -8,3 +8,20 @@ import (
 func getLastModification(st *syscall.Stat_t) syscall.Timespec {
 	return st.Mtim
 }
+
+// getLastAccess returns the access time
+func getLastAccess(st *syscall.Stat_t) syscall.Timespec {
+	return st.Atim
+}
+
+// getLastChange returns the status change time
+func getLastChange(st *syscall.Stat_t) syscall.Timespec {
+	return st.Ctim
+}
+
+// splitDev returns the major and minor numbers of the device number dev
+func splitDev(dev uint64) (major uint32, minor uint32) {
+	major = uint32((dev>>8)&0xfff) | uint32((dev>>32)&^0xfff)
+	minor = uint32(dev&0xff) | uint32((dev>>12)&^0xff)
+	return major, minor
+}
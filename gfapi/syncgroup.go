@@ -0,0 +1,101 @@
+package gfapi
+
+// This file includes the SyncGroup type, which coalesces the fsyncs of
+// concurrent writers of the same Fd
+
+import (
+	"sync"
+	"time"
+)
+
+// SyncGroup coalesces the durability requests of many goroutines into a
+// single Fsync per Fd, the group commit pattern. A goroutine which needs its
+// writes to be durable calls WaitSync, and all the WaitSync calls made on an
+// Fd within the window are served by the same Fsync.
+//
+// A WaitSync call is only ever served by an Fsync started after it was made,
+// so the writes completed before WaitSync are always covered. A call made
+// while an Fsync is in flight waits for the next one.
+//
+// A SyncGroup is safe for concurrent use, its zero value has no window.
+type SyncGroup struct {
+	window time.Duration
+
+	mu  sync.Mutex
+	fds map[*Fd]*syncState
+}
+
+// syncState is the state of the syncs of an Fd of a SyncGroup. pending is the
+// batch which the next Fsync will serve, nil if no WaitSync is waiting for it.
+type syncState struct {
+	pending *syncBatch
+}
+
+// syncBatch is the set of WaitSync calls served by the same Fsync. done is
+// closed once err holds the result of the Fsync.
+type syncBatch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewSyncGroup returns a SyncGroup which waits for window after the first
+// WaitSync on an Fd before starting the Fsync, to gather the WaitSync calls
+// of the other writers. A longer window saves more fsyncs but adds to the
+// latency of each WaitSync.
+func NewSyncGroup(window time.Duration) *SyncGroup {
+	return &SyncGroup{window: window}
+}
+
+// WaitSync waits until the data written to fd before the call has been
+// committed to the storage by an Fsync shared with the other WaitSync calls
+// on fd.
+//
+// Returns the error of the shared Fsync
+func (g *SyncGroup) WaitSync(fd *Fd) error {
+	if fd.fd == nil {
+		return ErrClosed
+	}
+
+	g.mu.Lock()
+	if g.fds == nil {
+		g.fds = make(map[*Fd]*syncState)
+	}
+	st := g.fds[fd]
+	if st == nil {
+		st = &syncState{}
+		g.fds[fd] = st
+		go g.run(fd, st)
+	}
+	if st.pending == nil {
+		st.pending = &syncBatch{done: make(chan struct{})}
+	}
+	b := st.pending
+	g.mu.Unlock()
+
+	<-b.done
+	return b.err
+}
+
+// run issues the Fsyncs of fd for as long as WaitSync calls keep coming. The
+// pending batch is detached before each Fsync starts, so the calls made during
+// the Fsync join the next batch.
+func (g *SyncGroup) run(fd *Fd, st *syncState) {
+	for {
+		if g.window > 0 {
+			time.Sleep(g.window)
+		}
+
+		g.mu.Lock()
+		b := st.pending
+		st.pending = nil
+		if b == nil {
+			delete(g.fds, fd)
+			g.mu.Unlock()
+			return
+		}
+		g.mu.Unlock()
+
+		b.err = fd.Fsync(nil, nil)
+		close(b.done)
+	}
+}
@@ -57,46 +57,30 @@ func (fs *fileInfo) IsDir() bool {
 	return fs.mode.IsDir()
 }
 
+// Sys returns the underlying data source of the fileInfo. It is always a
+// *syscall.Stat_t, so it is safe to type-assert to get at fields like Ino,
+// Nlink and Blocks which are not part of the os.FileInfo interface.
 func (fs *fileInfo) Sys() interface{} {
 	return fs.sys
 }
 
 // fileInfoFromStat() returns an os.FileInfo struct from the given syscall.Stat_t struc
 //
-// Based on the fileInfoFromStat function in the pkg/os/stat_linux.go file in the Go source
+// Based on the fileInfoFromStat function in the pkg/os/stat_linux.go file in the Go source.
+// The given stat is copied, so callers are free to reuse st afterwards.
+//
+// st is taken as it is, so for the lstat-style stat of a symlink, like those
+// of Lstat and readdirplus, the mode has os.ModeSymlink set and the size is the
+// length of the link target, not the size of the file it points to.
 func fileInfoFromStat(st *syscall.Stat_t, name string) os.FileInfo {
+	sys := *st
 	fs := &fileInfo{
 		name:    path.Base(name),
 		size:    int64(st.Size),
 		modTime: timespecToTime(getLastModification(st)),
-		sys:     st,
-	}
-	fs.mode = os.FileMode(st.Mode & 0777)
-	switch st.Mode & syscall.S_IFMT {
-	case syscall.S_IFBLK:
-		fs.mode |= os.ModeDevice
-	case syscall.S_IFCHR:
-		fs.mode |= os.ModeDevice | os.ModeCharDevice
-	case syscall.S_IFDIR:
-		fs.mode |= os.ModeDir
-	case syscall.S_IFIFO:
-		fs.mode |= os.ModeNamedPipe
-	case syscall.S_IFLNK:
-		fs.mode |= os.ModeSymlink
-	case syscall.S_IFREG:
-		// nothing to do
-	case syscall.S_IFSOCK:
-		fs.mode |= os.ModeSocket
-	}
-	if st.Mode&syscall.S_ISGID != 0 {
-		fs.mode |= os.ModeSetgid
-	}
-	if st.Mode&syscall.S_ISUID != 0 {
-		fs.mode |= os.ModeSetuid
-	}
-	if st.Mode&syscall.S_ISVTX != 0 {
-		fs.mode |= os.ModeSticky
+		sys:     &sys,
 	}
+	fs.mode = GlfsToMode(uint32(st.Mode))
 	return fs
 }
 
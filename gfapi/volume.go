@@ -174,13 +174,14 @@ func (v *Volume) Create(name string) (*File, error) {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
-	cfd, err := C.glfs_creat(v.fs, cname, C.int(os.O_RDWR|os.O_CREATE|os.O_TRUNC), 0666)
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	cfd, err := C.glfs_creat(v.fs, cname, C.int(flags), 0666)
 
 	if cfd == nil {
 		return nil, &os.PathError{Op: "create", Path: name, Err: err}
 	}
 
-	return &File{name, Fd{cfd}, false}, nil
+	return &File{name, Fd{fd: cfd, flags: flags}}, nil
 }
 
 // Unlink attempts to unlink a file a path and returns a non-nil error on failure.
@@ -197,6 +198,7 @@ func (v *Volume) Unlink(path string) error {
 }
 
 // Lstat returns an os.FileInfo object describing the named file. It doesn't follow the link if the file is a symlink.
+// The Sys method of the returned os.FileInfo returns a *syscall.Stat_t.
 //
 // Returns an error on failure
 func (v *Volume) Lstat(name string) (os.FileInfo, error) {
@@ -317,7 +319,7 @@ func (v *Volume) Open(name string) (*File, error) {
 		return nil, &os.PathError{Op: "open", Path: name, Err: err}
 	}
 
-	return &File{name, Fd{cfd}, isDir}, nil
+	return &File{name, Fd{fd: cfd, flags: os.O_RDONLY, isDir: isDir}}, nil
 }
 
 // OpenFile opens the named file on the the Volume v.
@@ -333,13 +335,55 @@ func (v *Volume) Open(name string) (*File, error) {
 // BUG : perm is not used for opening the file.
 // NOTE: It is better to use Open, Create etc. instead of using OpenFile directly
 func (v *Volume) OpenFile(name string, flags int, perm os.FileMode) (*File, error) {
-	isDir := false
+	cfd, isDir, err := v.openFd(name, flags, perm)
+	if cfd == nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &File{name, Fd{fd: cfd, flags: flags, isDir: isDir}}, nil
+}
+
+// Reopen opens the named file like OpenFile, but reuses the closed File f
+// instead of allocating a new one. It is meant for pools of File objects.
+//
+// Returns ErrNotClosed if f is still open, and a os.PathError if opening the
+// file fails
+func (v *Volume) Reopen(f *File, name string, flags int, perm os.FileMode) error {
+	f.Fd.mu.Lock()
+	closed := f.Fd.fd == nil
+	f.Fd.mu.Unlock()
+	if !closed {
+		return ErrNotClosed
+	}
+
+	cfd, isDir, err := v.openFd(name, flags, perm)
+	if cfd == nil {
+		return &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	// Serialize with Close and the concurrent calls to Reopen, the loser of a
+	// race closes the fd it opened
+	f.Fd.mu.Lock()
+	defer f.Fd.mu.Unlock()
+
+	if err := f.Fd.reset(cfd, flags, isDir); err != nil {
+		if isDir {
+			C.glfs_closedir(cfd)
+		} else {
+			C.glfs_close(cfd)
+		}
+		return err
+	}
+	f.name = name
+	return nil
+}
 
+// openFd opens the named file with glfs_open, glfs_creat or glfs_opendir
+// depending on flags and the type of the file
+func (v *Volume) openFd(name string, flags int, perm os.FileMode) (cfd *C.glfs_fd_t, isDir bool, err error) {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
-	var cfd *C.glfs_fd_t
-	var err error
 	if (os.O_CREATE & flags) == os.O_CREATE {
 		cfd, err = C.glfs_creat(v.fs, cname, C.int(flags), C.mode_t(posixMode(perm)))
 	} else {
@@ -351,15 +395,11 @@ func (v *Volume) OpenFile(name string, flags int, perm os.FileMode) (*File, erro
 		isDir = true
 		cfd, err = C.glfs_opendir(v.fs, cname)
 	}
-
-	if cfd == nil {
-		return nil, &os.PathError{Op: "open", Path: name, Err: err}
-	}
-
-	return &File{name, Fd{cfd}, isDir}, nil
+	return cfd, isDir, err
 }
 
-// Stat returns an os.FileInfo object describing the named file
+// Stat returns an os.FileInfo object describing the named file.
+// The Sys method of the returned os.FileInfo returns a *syscall.Stat_t.
 //
 // Returns an error on failure
 func (v *Volume) Stat(name string) (os.FileInfo, error) {
@@ -410,6 +450,23 @@ func (v *Volume) Rename(oldpath string, newpath string) error {
 	return nil
 }
 
+// Symlink creates newname as a symbolic link to oldname
+//
+// Returns error on failure
+func (v *Volume) Symlink(oldname string, newname string) error {
+	coldname := C.CString(oldname)
+	defer C.free(unsafe.Pointer(coldname))
+
+	cnewname := C.CString(newname)
+	defer C.free(unsafe.Pointer(cnewname))
+
+	ret, err := C.glfs_symlink(v.fs, coldname, cnewname)
+	if int(ret) < 0 {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
 // Get value of the extended attribute 'attr' and place it in 'dest'
 //
 // Returns number of bytes placed in 'dest' and error if any
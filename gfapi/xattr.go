@@ -0,0 +1,211 @@
+package gfapi
+
+// This file includes helpers built on the extended attribute operations on fd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// ErrNoAttr is returned when the requested extended attribute doesn't exist.
+// It satisfies errors.Is(err, syscall.ENODATA) on Linux and
+// errors.Is(err, syscall.ENOATTR) on Darwin.
+var ErrNoAttr = fmt.Errorf("no such attribute: %w", errNoAttr)
+
+// FgetxattrSize returns the size of the value of the extended attribute attr,
+// the length of the buffer needed by Fgetxattr
+//
+// Returns ErrNoAttr if the attribute doesn't exist and error on failure
+func (fd *Fd) FgetxattrSize(attr string) (int64, error) {
+	size, err := fd.Fgetxattr(attr, nil)
+	if err == errNoAttr {
+		return 0, ErrNoAttr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// GetxattrAll returns the whole value of the extended attribute attr. The
+// size of the value is probed first, and probed again if the value grows in
+// between.
+//
+// Returns ErrNoAttr if the attribute doesn't exist and error on failure
+func (fd *Fd) GetxattrAll(attr string) ([]byte, error) {
+	for {
+		size, err := fd.FgetxattrSize(attr)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return []byte{}, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := fd.Fgetxattr(attr, buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err == errNoAttr {
+			return nil, ErrNoAttr
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// FgetxattrInto reads the value of the extended attribute attr into dest,
+// which the caller can reuse across calls, e.g. drawn from a sync.Pool. No Go
+// memory is allocated, only the C copy of attr.
+//
+// When the value doesn't fit in dest no error is returned, truncated is true
+// and n is 0, as libgfapi copies nothing in that case: the contents of dest
+// are unspecified and FgetxattrSize tells the length needed.
+//
+// Returns the number of bytes placed in dest, ErrNoAttr if the attribute
+// doesn't exist and error on failure
+func (fd *Fd) FgetxattrInto(attr string, dest []byte) (n int, truncated bool, err error) {
+	size, err := fd.Fgetxattr(attr, dest)
+	if err == syscall.ERANGE {
+		return 0, true, nil
+	}
+	if err == errNoAttr {
+		return 0, false, ErrNoAttr
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	// An empty dest makes glfs_fgetxattr return the size of the value
+	if len(dest) == 0 && size > 0 {
+		return 0, true, nil
+	}
+	return int(size), false, nil
+}
+
+// ListxattrAll returns the names of all the extended attributes of the file.
+// The length of the names is probed first, and probed again if the names grow
+// in between.
+//
+// Returns error on failure
+func (fd *Fd) ListxattrAll() ([]string, error) {
+	for {
+		size, err := fd.Flistxattr(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := fd.Flistxattr(buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, name := range bytes.Split(buf[:n], []byte{0}) {
+			if len(name) > 0 {
+				names = append(names, string(name))
+			}
+		}
+		return names, nil
+	}
+}
+
+// GetAllXattrs returns the values of the extended attributes of the file
+// whose name starts with prefix, e.g. "user.", keyed by name. An empty prefix
+// returns all of them. The names are listed first and each value is then read
+// with GetxattrAll, the attributes removed in between are skipped.
+//
+// Returns error on failure
+func (fd *Fd) GetAllXattrs(prefix string) (map[string][]byte, error) {
+	names, err := fd.ListxattrAll()
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		value, err := fd.GetxattrAll(name)
+		if err == ErrNoAttr {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getxattr %q: %w", name, err)
+		}
+		attrs[name] = value
+	}
+	return attrs, nil
+}
+
+// RemoveXattrs removes the extended attributes attrs from the file. The
+// attributes which don't exist are skipped, and a failure doesn't stop the
+// removal of the following attributes.
+//
+// Returns nil if all the attributes are gone, and otherwise the failures,
+// each naming its attribute, joined with errors.Join
+func (fd *Fd) RemoveXattrs(attrs []string) error {
+	var errs []error
+	for _, attr := range attrs {
+		err := fd.Fremovexattr(attr)
+		if err == nil || err == errNoAttr {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("removexattr %q: %w", attr, err))
+		if err == ErrClosed {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetxattrUint64 returns the value of the extended attribute attr decoded as
+// an 8 byte integer in the given byte order
+//
+// Returns ErrNoAttr if the attribute doesn't exist, an error if its value
+// isn't 8 bytes long and error on failure
+func (fd *Fd) GetxattrUint64(attr string, order binary.ByteOrder) (uint64, error) {
+	var b [8]byte
+	n, err := fd.Fgetxattr(attr, b[:])
+	if err == syscall.ERANGE {
+		size, err := fd.FgetxattrSize(attr)
+		if err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("xattr %q is %d bytes long, not 8", attr, size)
+	}
+	if err == errNoAttr {
+		return 0, ErrNoAttr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n != 8 {
+		return 0, fmt.Errorf("xattr %q is %d bytes long, not 8", attr, n)
+	}
+	return order.Uint64(b[:]), nil
+}
+
+// SetxattrUint64 sets the extended attribute attr to v encoded as an 8 byte
+// integer in the given byte order. flags are those of Fsetxattr.
+//
+// Returns error on failure
+func (fd *Fd) SetxattrUint64(attr string, v uint64, order binary.ByteOrder, flags int) error {
+	var b [8]byte
+	order.PutUint64(b[:], v)
+	return fd.Fsetxattr(attr, b[:], flags)
+}
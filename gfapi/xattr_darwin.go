@@ -0,0 +1,6 @@
+package gfapi
+
+import "syscall"
+
+// errNoAttr is the errno of a missing extended attribute
+const errNoAttr = syscall.ENOATTR